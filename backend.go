@@ -0,0 +1,224 @@
+package notify_lock_session
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"runtime"
+	"sort"
+	"sync"
+)
+
+// Capability is a set of things a backend can report.
+type Capability uint
+
+const (
+	// CapLock - lock and unlock transitions.
+	CapLock Capability = 1 << iota
+	// CapScreenSaver - screensaver start and stop.
+	CapScreenSaver
+	// CapSession - logon/logoff, connect/disconnect, create/terminate.
+	CapSession
+	// CapState - the current state can be queried with State.
+	CapState
+)
+
+// Has reports whether c includes all of o.
+func (c Capability) Has(o Capability) bool {
+	return c&o == o
+}
+
+// Backend is a source of session events.
+type Backend interface {
+	// Name is the name the backend is registered under, it is also
+	// reported in Lock.Backend.
+	Name() string
+	// Start returns once the backend is listening. Events are sent to
+	// events until ctx is done or Stop is called.
+	Start(ctx context.Context, events chan<- Lock) error
+	Stop() error
+	// State returns the current state as a snapshot event.
+	State(ctx context.Context) (Lock, error)
+	Capabilities() Capability
+	// Err returns the error that stopped the backend after Start returned.
+	Err() error
+}
+
+// CapabilityError is returned by Start when the backend cannot work on this
+// system, e.g. because a program it needs is not installed. It matches
+// errors.ErrUnsupported.
+type CapabilityError struct {
+	Backend string
+	Err     error
+}
+
+func (e *CapabilityError) Error() string { return "not available: " + e.Err.Error() }
+
+func (e *CapabilityError) Unwrap() error { return e.Err }
+
+func (e *CapabilityError) Is(target error) bool { return target == errors.ErrUnsupported }
+
+// Factory creates a new instance of a registered backend.
+type Factory func() (Backend, error)
+
+var (
+	registryMu sync.RWMutex
+	registry   = map[string]Factory{}
+)
+
+// Register makes a backend available to WithBackend under name. Registering
+// an existing name replaces it.
+func Register(name string, factory Factory) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	registry[name] = factory
+}
+
+// Registered returns the sorted names of the registered backends.
+func Registered() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func newBackend(name string) (Backend, error) {
+	registryMu.RLock()
+	factory, ok := registry[name]
+	registryMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownBackend, name)
+	}
+	b, err := factory()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	return b, nil
+}
+
+// backends returns the backends selected by the options, or the platform
+// default when none were selected.
+func (l *NotifyLock) backends(ctx context.Context) ([]Backend, error) {
+	if len(l.errs) > 0 {
+		return nil, errors.Join(l.errs...)
+	}
+	res := make([]Backend, 0, len(l.names)+len(l.instances))
+	if len(l.names) == 0 && len(l.instances) == 0 {
+		defaults, err := defaultBackends(ctx, l.bus)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, defaults...)
+	}
+	for _, name := range l.names {
+		b, err := newBackend(name)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, b)
+	}
+	for _, b := range res {
+		if bb, ok := b.(busBackend); ok && l.bus != "" {
+			bb.setBus(l.bus)
+		}
+	}
+	res = append(res, l.instances...)
+	if len(res) == 0 {
+		return nil, fmt.Errorf("%w: no backend for %s", ErrUnknownBackend, runtime.GOOS)
+	}
+	return res, nil
+}
+
+// hasCapability reports whether any of backends has c.
+func hasCapability(backends []Backend, c Capability) bool {
+	for _, b := range backends {
+		if b.Capabilities().Has(c) {
+			return true
+		}
+	}
+	return false
+}
+
+// stateOf returns the first locked state reported by backends, otherwise
+// the first state reported without an error.
+func stateOf(ctx context.Context, backends []Backend) (Lock, error) {
+	states, err := statesOf(ctx, backends)
+	if err != nil {
+		return Lock{}, err
+	}
+	res, _ := lockedFirst(states)
+	return res, nil
+}
+
+// statesOf queries the backends that report their state. The error is
+// returned only when no backend reported.
+func statesOf(ctx context.Context, backends []Backend) ([]Lock, error) {
+	var (
+		res  []Lock
+		errs []error
+	)
+	for _, b := range backends {
+		if !b.Capabilities().Has(CapState) {
+			continue
+		}
+		state, err := b.State(ctx)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", b.Name(), err))
+			continue
+		}
+		res = append(res, state)
+	}
+	if len(res) > 0 {
+		return res, nil
+	}
+	if len(errs) == 0 {
+		return nil, errors.New("no backend reports the session state")
+	}
+	return nil, errors.Join(errs...)
+}
+
+// baseBackend keeps the runtime state shared by the built-in backends.
+type baseBackend struct {
+	mu     sync.Mutex
+	cancel context.CancelFunc
+	err    error
+}
+
+// watch derives the context the backend runs under until Stop.
+func (b *baseBackend) watch(ctx context.Context) context.Context {
+	ctx, cancel := context.WithCancel(ctx)
+	b.mu.Lock()
+	b.cancel = cancel
+	b.err = nil
+	b.mu.Unlock()
+	return ctx
+}
+
+func (b *baseBackend) Stop() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.cancel != nil {
+		b.cancel()
+	}
+	return nil
+}
+
+func (b *baseBackend) Err() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.err
+}
+
+func (b *baseBackend) setErr(err error) {
+	if err != nil {
+		slog.Error("Watch session", slog.Any("error", err))
+	}
+	b.mu.Lock()
+	b.err = err
+	b.mu.Unlock()
+}
@@ -0,0 +1,11 @@
+//go:build !linux && !windows && !(darwin && cgo)
+
+package notify_lock_session
+
+import "context"
+
+// defaultBackends has nothing to offer on this platform; only backends
+// selected explicitly are used.
+func defaultBackends(ctx context.Context, bus string) ([]Backend, error) {
+	return nil, nil
+}
@@ -0,0 +1,171 @@
+package notify_lock_session
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+	"testing"
+	"time"
+)
+
+// stubBackend sends the events written to its in channel.
+type stubBackend struct {
+	baseBackend
+	name  string
+	state Lock
+	in    chan Lock
+}
+
+func newStubBackend(name string, locked bool) *stubBackend {
+	return &stubBackend{
+		name:  name,
+		state: newSnapshot(lockedKind(locked), name, "stub"),
+		in:    make(chan Lock),
+	}
+}
+
+func (b *stubBackend) Name() string             { return b.name }
+func (b *stubBackend) Capabilities() Capability { return CapLock | CapState }
+
+func (b *stubBackend) State(context.Context) (Lock, error) { return b.state, nil }
+
+func (b *stubBackend) Start(ctx context.Context, events chan<- Lock) error {
+	ctx = b.watch(ctx)
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case l := <-b.in:
+				send(ctx, events, l)
+			}
+		}
+	}()
+	return nil
+}
+
+func nextLock(t *testing.T, lock chan Lock) Lock {
+	t.Helper()
+	select {
+	case l := <-lock:
+		return l
+	case <-time.After(5 * time.Second):
+		t.Fatal("no event received")
+	}
+	return Lock{}
+}
+
+func TestRegistry(t *testing.T) {
+	a := newStubBackend("stub-a", false)
+	Register("stub-a", func() (Backend, error) { return a, nil })
+	Register("stub-broken", func() (Backend, error) { return nil, errors.New("broken") })
+
+	found := false
+	for _, name := range Registered() {
+		found = found || name == "stub-a"
+	}
+	if !found {
+		t.Errorf("Registered() = %q", Registered())
+	}
+
+	if _, err := New(WithBackend("stub-missing")).State(context.Background()); !errors.Is(err, ErrUnknownBackend) {
+		t.Errorf("unknown backend: %v", err)
+	}
+	if err := New(WithBackend("stub-broken")).Subscribe(context.Background(), nil); err == nil {
+		t.Error("broken factory: Subscribe() succeeded")
+	}
+}
+
+func TestCombinedBackends(t *testing.T) {
+	a := newStubBackend("stub-a", false)
+	b := newStubBackend("stub-b", true)
+	Register("stub-a", func() (Backend, error) { return a, nil })
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	lock := make(chan Lock)
+	nl := New(WithBackend("stub-a"), UseBackend(b))
+	if err := nl.Subscribe(ctx, lock); err != nil {
+		t.Fatal(err)
+	}
+
+	// Заблокированное состояние побеждает.
+	if l := nextLock(t, lock); !l.Snapshot || l.Backend != "stub-b" {
+		t.Errorf("snapshot = %+v", l)
+	}
+	a.in <- newLock(EventLocked, "stub-a", "stub")
+	if l := nextLock(t, lock); l.Backend != "stub-a" || l.Kind != EventLocked {
+		t.Errorf("event from a = %+v", l)
+	}
+	b.in <- newLock(EventUnlocked, "stub-b", "stub")
+	if l := nextLock(t, lock); l.Backend != "stub-b" || l.Kind != EventUnlocked {
+		t.Errorf("event from b = %+v", l)
+	}
+
+	b.setErr(errors.New("gone"))
+	if err := nl.Err(); err == nil {
+		t.Error("Err() did not report the backend error")
+	}
+}
+
+// statelessBackend is a stubBackend without CapState, like logind-sessions.
+type statelessBackend struct {
+	*stubBackend
+}
+
+func (b statelessBackend) Capabilities() Capability { return CapLock | CapSession }
+
+// logRecorder collects the messages logged through slog.
+type logRecorder struct {
+	mu   sync.Mutex
+	msgs []string
+}
+
+func recordLogs(t *testing.T) *logRecorder {
+	r := &logRecorder{}
+	prev := slog.Default()
+	slog.SetDefault(slog.New(r))
+	t.Cleanup(func() { slog.SetDefault(prev) })
+	return r
+}
+
+func (r *logRecorder) Enabled(context.Context, slog.Level) bool { return true }
+func (r *logRecorder) WithAttrs([]slog.Attr) slog.Handler       { return r }
+func (r *logRecorder) WithGroup(string) slog.Handler            { return r }
+
+func (r *logRecorder) Handle(_ context.Context, rec slog.Record) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.msgs = append(r.msgs, rec.Message)
+	return nil
+}
+
+func (r *logRecorder) messages() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string(nil), r.msgs...)
+}
+
+func TestStatelessBackend(t *testing.T) {
+	logs := recordLogs(t)
+	b := statelessBackend{newStubBackend("stub-stateless", false)}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	lock := make(chan Lock)
+	if err := New(UseBackend(b)).Subscribe(ctx, lock); err != nil {
+		t.Fatal(err)
+	}
+
+	// Снимка нет, первым приходит событие.
+	b.in <- newLock(EventLocked, "stub-stateless", "stub")
+	if l := nextLock(t, lock); l.Snapshot || l.Kind != EventLocked {
+		t.Errorf("first event = %+v", l)
+	}
+	for _, msg := range logs.messages() {
+		if msg == "Initial session state" {
+			t.Errorf("logged %q", msg)
+		}
+	}
+}
@@ -0,0 +1,29 @@
+package notify_lock_session
+
+import "strconv"
+
+// WithBus selects the bus of the session backends instead of the session
+// bus of the environment (DBUS_SESSION_BUS_ADDRESS): "session", "system",
+// a D-Bus address such as "unix:path=/run/user/1000/bus", or UserBus(uid).
+// It is meant for system services that run without a session and has no
+// effect on Windows and macOS.
+func WithBus(bus string) Option {
+	return func(l *NotifyLock) {
+		l.bus = bus
+	}
+}
+
+// UserBus is the session bus of the user uid, /run/user/<uid>/bus. When
+// the process runs as another user it authenticates as uid, which
+// requires root or CAP_SETUID. The logind backend then watches the
+// display session of that user.
+func UserBus(uid int) string {
+	return userBusPrefix + strconv.Itoa(uid)
+}
+
+const userBusPrefix = "user:"
+
+// busBackend is a backend connecting to the bus selected by WithBus.
+type busBackend interface {
+	setBus(bus string)
+}
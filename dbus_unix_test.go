@@ -0,0 +1,133 @@
+//go:build linux
+
+package notify_lock_session
+
+import (
+	"bufio"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+)
+
+const testBusConfig = `<!DOCTYPE busconfig PUBLIC "-//freedesktop//DTD D-Bus Bus Configuration 1.0//EN"
+ "http://www.freedesktop.org/standards/dbus/1.0/busconfig.dtd">
+<busconfig>
+  <type>session</type>
+  <listen>unix:path=%SOCKET%</listen>
+  <auth>EXTERNAL</auth>
+  <policy context="default">
+    <allow send_destination="*" eavesdrop="true"/>
+    <allow eavesdrop="true"/>
+    <allow own="*"/>
+  </policy>
+</busconfig>
+`
+
+// startTestBus runs a private dbus-daemon for the test and returns its
+// address. The test is skipped when dbus-daemon is not installed.
+func startTestBus(t *testing.T) string {
+	t.Helper()
+	address, _ := startTestBusProcess(t)
+	return address
+}
+
+// startTestBusProcess is startTestBus that also returns the daemon process,
+// so the test can kill the bus.
+func startTestBusProcess(t *testing.T) (string, *exec.Cmd) {
+	t.Helper()
+	return startTestBusIn(t, t.TempDir())
+}
+
+// startTestBusIn starts the daemon with its socket in dir. Starting it
+// again in the same dir restarts the bus at the same address.
+func startTestBusIn(t *testing.T, dir string) (string, *exec.Cmd) {
+	t.Helper()
+	daemon, err := exec.LookPath("dbus-daemon")
+	if err != nil {
+		t.Skip("dbus-daemon not found")
+	}
+	config := filepath.Join(dir, "bus.conf")
+	socket := filepath.Join(dir, "bus")
+	_ = os.Remove(socket)
+	err = os.WriteFile(config, []byte(strings.ReplaceAll(testBusConfig, "%SOCKET%", socket)), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cmd := exec.Command(daemon, "--config-file="+config, "--nofork", "--print-address")
+	out, err := cmd.StdoutPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_ = cmd.Process.Kill()
+		_ = cmd.Wait()
+	})
+
+	address := make(chan string, 1)
+	go func() {
+		line, _ := bufio.NewReader(out).ReadString('\n')
+		address <- strings.TrimSpace(line)
+	}()
+	select {
+	case a := <-address:
+		return a, cmd
+	case <-time.After(5 * time.Second):
+		t.Fatal("dbus-daemon did not report its address")
+	}
+	return "", nil
+}
+
+// connectTestBus connects to the private bus and closes the connection
+// when the test ends.
+func connectTestBus(t *testing.T, address string) *dbus.Conn {
+	t.Helper()
+	conn, err := dbus.Connect(address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+	return conn
+}
+
+// requestName makes conn the primary owner of name.
+func requestName(t *testing.T, conn *dbus.Conn, name string) {
+	t.Helper()
+	reply, err := conn.RequestName(name, dbus.NameFlagDoNotQueue)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reply != dbus.RequestNameReplyPrimaryOwner {
+		t.Fatalf("%s: name already taken", name)
+	}
+}
+
+// receive waits for the next event on lock.
+func receive(t *testing.T, lock chan Lock) Lock {
+	t.Helper()
+	select {
+	case l := <-lock:
+		return l
+	case <-time.After(5 * time.Second):
+		t.Fatal("no event received")
+	}
+	return Lock{}
+}
+
+// expectKind waits for the next event and checks its kind and source.
+func expectKind(t *testing.T, lock chan Lock, kind EventKind, source string) Lock {
+	t.Helper()
+	l := receive(t, lock)
+	if l.Kind != kind || l.Source != source {
+		t.Fatalf("got %s from %q, want %s from %q", l.Kind, l.Source, kind, source)
+	}
+	return l
+}
@@ -0,0 +1,307 @@
+//go:build linux
+
+package notify_lock_session
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/godbus/dbus/v5"
+)
+
+// screenSaverService is a screensaver interface on the session bus and the
+// desktops (XDG_CURRENT_DESKTOP entries, lower case) that provide it.
+type screenSaverService struct {
+	desktops []string
+	param    paramDBUS
+	// x11Only is set for screensavers that do not work in a Wayland
+	// session of their desktop.
+	x11Only bool
+}
+
+// screenSaverServices are the known services in order of preference when
+// the desktop is not recognised.
+var screenSaverServices = []screenSaverService{
+	{
+		desktops: []string{"gnome", "ubuntu", "gnome-classic", "gnome-flashback", "pantheon"},
+		param: paramDBUS{
+			dest:      "org.gnome.ScreenSaver",
+			path:      "/org/gnome/ScreenSaver",
+			iface:     "org.gnome.ScreenSaver",
+			member:    "ActiveChanged",
+			getActive: "org.gnome.ScreenSaver.GetActive",
+		},
+	},
+	{
+		// Стандартный интерфейс freedesktop: light-locker (LXDE, LXQt,
+		// старый Pantheon) и любой другой совместимый блокировщик.
+		desktops: []string{"lxde", "lxqt", "pantheon"},
+		param: paramDBUS{
+			dest:      "org.freedesktop.ScreenSaver",
+			path:      "/org/freedesktop/ScreenSaver",
+			altPaths:  []dbus.ObjectPath{"/ScreenSaver"},
+			iface:     "org.freedesktop.ScreenSaver",
+			member:    "ActiveChanged",
+			getActive: "org.freedesktop.ScreenSaver.GetActive",
+		},
+	},
+	{
+		desktops: []string{"kde"},
+		param: paramDBUS{
+			dest:      "org.freedesktop.ScreenSaver",
+			path:      "/ScreenSaver",
+			iface:     "org.kde.screensaver",
+			member:    "ActiveChanged",
+			getActive: "org.freedesktop.ScreenSaver.GetActive",
+		},
+	},
+	{
+		desktops: []string{"x-cinnamon", "cinnamon"},
+		param: paramDBUS{
+			dest:      "org.cinnamon.ScreenSaver",
+			path:      "/org/cinnamon/ScreenSaver",
+			iface:     "org.cinnamon.ScreenSaver",
+			member:    "ActiveChanged",
+			getActive: "org.cinnamon.ScreenSaver.GetActive",
+		},
+		x11Only: true,
+	},
+	{
+		desktops: []string{"xfce"},
+		param: paramDBUS{
+			dest:      "org.xfce.ScreenSaver",
+			path:      "/org/xfce/ScreenSaver",
+			iface:     "org.xfce.ScreenSaver",
+			member:    "ActiveChanged",
+			getActive: "org.xfce.ScreenSaver.GetActive",
+		},
+		x11Only: true,
+	},
+	{
+		desktops: []string{"mate"},
+		param: paramDBUS{
+			dest:      "org.mate.ScreenSaver",
+			path:      "/org/mate/ScreenSaver",
+			iface:     "org.mate.ScreenSaver",
+			member:    "ActiveChanged",
+			getActive: "org.mate.ScreenSaver.GetActive",
+		},
+		x11Only: true,
+	},
+	{
+		// budgie-screensaver с версии 5.1, раньше Budgie использовал
+		// gnome-screensaver.
+		desktops: []string{"budgie"},
+		param: paramDBUS{
+			dest:      "org.buddiesofbudgie.BudgieScreensaver",
+			path:      "/org/buddiesofbudgie/BudgieScreensaver",
+			iface:     "org.buddiesofbudgie.BudgieScreensaver",
+			member:    "ActiveChanged",
+			getActive: "org.buddiesofbudgie.BudgieScreensaver.GetActive",
+		},
+		x11Only: true,
+	},
+	{
+		// Deepin не шлёт ActiveChanged, блокировку отражает свойство Locked.
+		desktops: []string{"deepin"},
+		param: paramDBUS{
+			dest:     "com.deepin.SessionManager",
+			path:     "/com/deepin/SessionManager",
+			iface:    "com.deepin.SessionManager",
+			property: "Locked",
+			locks:    true,
+		},
+	},
+	{
+		desktops: []string{"unity"},
+		param: paramDBUS{
+			dest:   "com.canonical.Unity",
+			iface:  "com.canonical.Unity",
+			member: "ActiveChanged",
+		},
+		x11Only: true,
+	},
+}
+
+// lockerDesktops are the compositors and window managers that lock the
+// screen with a locker process instead of a screensaver service.
+var lockerDesktops = []string{"sway", "hyprland", "i3", "river", "wayfire", "niri", "labwc", "qtile", "bspwm", "dwm"}
+
+// Candidate is a screensaver service considered by DetectDesktop.
+type Candidate struct {
+	Service string
+	// Desktop is the matching XDG_CURRENT_DESKTOP entry, empty when the
+	// service is not associated with the current desktop.
+	Desktop string
+	Running bool
+	// X11Only services are not matched to the desktop in a Wayland
+	// session.
+	X11Only bool
+	Score   int
+}
+
+// Detection is the backend chosen by DetectDesktop and why.
+type Detection struct {
+	Backend string
+	// Service is the bus name of the chosen screensaver, empty for logind.
+	Service string
+	// Desktops are the parsed entries of XDG_CURRENT_DESKTOP.
+	Desktops      []string
+	DisplayServer DisplayServer
+	Reason        string
+	Candidates    []Candidate
+
+	param paramDBUS
+}
+
+// parseDesktops splits XDG_CURRENT_DESKTOP ("ubuntu:GNOME:") into lower
+// case entries.
+func parseDesktops(env string) []string {
+	var res []string
+	for _, d := range strings.Split(env, ":") {
+		if d = strings.ToLower(strings.TrimSpace(d)); d != "" {
+			res = append(res, d)
+		}
+	}
+	return res
+}
+
+// DetectDesktop asks the session bus which screensaver services are running
+// and ranks them by XDG_CURRENT_DESKTOP; in a Wayland session the
+// screensavers that only work on X11 are not preferred. When none is
+// running the process backend is chosen on compositors and window managers
+// such as Sway, Hyprland or i3, logind otherwise. The returned Detection is
+// usable even with an error, which only reports that the session bus could
+// not be reached.
+func DetectDesktop(ctx context.Context) (Detection, error) {
+	return detectOnBus(ctx, "")
+}
+
+// detectOnBus is DetectDesktop on the bus selected by WithBus.
+func detectOnBus(ctx context.Context, bus string) (Detection, error) {
+	conn, err := connectBus(bus)
+	if err != nil {
+		return detectDesktop(ctx, nil), err
+	}
+	defer func() { _ = conn.Close() }()
+	return detectDesktop(ctx, conn), nil
+}
+
+// detectDesktop ranks the known services, conn may be nil when the session
+// bus is not available.
+func detectDesktop(ctx context.Context, conn *dbus.Conn) Detection {
+	d := Detection{
+		Desktops:      parseDesktops(os.Getenv("XDG_CURRENT_DESKTOP")),
+		DisplayServer: displayServer(func() SessionType { return logindSessionType(ctx) }),
+	}
+	running := runningNames(ctx, conn)
+	wayland := d.DisplayServer == DisplayServerWayland
+
+	for i, service := range screenSaverServices {
+		c := Candidate{
+			Service: service.param.dest,
+			Running: running(service.param.dest),
+			X11Only: service.x11Only,
+			// Порядок таблицы решает, если рабочий стол не распознан.
+			Score: len(screenSaverServices) - i,
+		}
+		desktops := d.Desktops
+		if wayland && c.X11Only {
+			// Под Wayland такая служба выбирается, только если запущена.
+			c.Score, desktops = 0, nil
+		}
+		for j, desktop := range desktops {
+			if contains(service.desktops, desktop) {
+				c.Desktop = desktop
+				c.Score += 100 * (len(d.Desktops) - j)
+				break
+			}
+		}
+		if c.Running {
+			c.Score += 1000
+		}
+		d.Candidates = append(d.Candidates, c)
+	}
+	order := make([]int, len(d.Candidates))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		return d.Candidates[order[a]].Score > d.Candidates[order[b]].Score
+	})
+	sorted := make([]Candidate, len(order))
+	for i, j := range order {
+		sorted[i] = d.Candidates[j]
+	}
+	d.Candidates = sorted
+	best := order[0]
+	d.param = screenSaverServices[best].param
+
+	wm := ""
+	for _, desktop := range d.Desktops {
+		if contains(lockerDesktops, desktop) {
+			wm = desktop
+			break
+		}
+	}
+
+	switch c := d.Candidates[0]; {
+	case (conn == nil || !c.Running) && wm != "":
+		d.Backend = BackendProcess
+		d.Reason = fmt.Sprintf("no screensaver service is running, %q locks with a locker process", wm)
+	case conn == nil:
+		d.Backend = BackendLogind
+		d.Reason = "session bus is not available"
+	case !c.Running:
+		d.Backend = BackendLogind
+		d.Reason = "no screensaver service is running on the session bus"
+	case c.Desktop != "":
+		d.Backend, d.Service = BackendDBus, c.Service
+		d.Reason = fmt.Sprintf("%s is running and matches desktop %q", c.Service, c.Desktop)
+	default:
+		d.Backend, d.Service = BackendDBus, c.Service
+		d.Reason = fmt.Sprintf("%s is running, desktop %q is not recognised", c.Service, os.Getenv("XDG_CURRENT_DESKTOP"))
+	}
+	return d
+}
+
+// runningNames returns a check whether a name has an owner on the bus.
+// It uses ListNames and falls back to NameHasOwner.
+func runningNames(ctx context.Context, conn *dbus.Conn) func(string) bool {
+	if conn == nil {
+		return func(string) bool { return false }
+	}
+	var names []string
+	err := conn.BusObject().CallWithContext(ctx, "org.freedesktop.DBus.ListNames", 0).Store(&names)
+	if err == nil {
+		return func(name string) bool { return name != "" && contains(names, name) }
+	}
+	return func(name string) bool {
+		if name == "" {
+			return false
+		}
+		var has bool
+		err := conn.BusObject().CallWithContext(ctx, "org.freedesktop.DBus.NameHasOwner", 0, name).Store(&has)
+		return err == nil && has
+	}
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+func logDetection(d Detection) {
+	slog.Info("Session backend detected",
+		slog.String("backend", d.Backend),
+		slog.String("service", d.Service),
+		slog.String("reason", d.Reason))
+}
@@ -0,0 +1,309 @@
+//go:build linux
+
+package notify_lock_session
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+	"github.com/godbus/dbus/v5/prop"
+)
+
+func TestParseDesktops(t *testing.T) {
+	tests := map[string][]string{
+		"GNOME":          {"gnome"},
+		"ubuntu:GNOME:":  {"ubuntu", "gnome"},
+		"KDE:plasma":     {"kde", "plasma"},
+		" X-Cinnamon ::": {"x-cinnamon"},
+		"":               nil,
+	}
+	for env, want := range tests {
+		if got := parseDesktops(env); !reflect.DeepEqual(got, want) {
+			t.Errorf("parseDesktops(%q) = %q, want %q", env, got, want)
+		}
+	}
+}
+
+func TestDetectDesktop(t *testing.T) {
+	address := startTestBus(t)
+	t.Setenv("DBUS_SESSION_BUS_ADDRESS", address)
+	ctx := context.Background()
+
+	t.Setenv("XDG_CURRENT_DESKTOP", "ubuntu:GNOME:")
+	d, err := DetectDesktop(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.Backend != BackendLogind || d.Service != "" {
+		t.Errorf("nothing running: %+v", d)
+	}
+	if !reflect.DeepEqual(d.Desktops, []string{"ubuntu", "gnome"}) {
+		t.Errorf("Desktops = %q", d.Desktops)
+	}
+
+	t.Setenv("XDG_CURRENT_DESKTOP", "sway")
+	if d, _ = DetectDesktop(ctx); d.Backend != BackendProcess {
+		t.Errorf("sway: %+v", d)
+	}
+	t.Setenv("XDG_CURRENT_DESKTOP", "ubuntu:GNOME:")
+
+	owner := connectTestBus(t, address)
+	requestName(t, owner, "org.gnome.ScreenSaver")
+	requestName(t, owner, "org.freedesktop.ScreenSaver")
+
+	d, _ = DetectDesktop(ctx)
+	if d.Backend != BackendDBus || d.Service != "org.gnome.ScreenSaver" || d.Candidates[0].Desktop != "ubuntu" {
+		t.Errorf("GNOME: %+v", d)
+	}
+
+	t.Setenv("XDG_CURRENT_DESKTOP", "KDE:plasma")
+	d, _ = DetectDesktop(ctx)
+	if d.Backend != BackendDBus || d.param.iface != "org.kde.screensaver" || d.Candidates[0].Desktop != "kde" {
+		t.Errorf("KDE: %+v", d)
+	}
+
+	// Неизвестный рабочий стол: выбирается запущенная служба.
+	t.Setenv("XDG_CURRENT_DESKTOP", "Hyprland")
+	d, _ = DetectDesktop(ctx)
+	if d.Backend != BackendDBus || d.Service != "org.gnome.ScreenSaver" || d.Candidates[0].Desktop != "" {
+		t.Errorf("unknown desktop: %+v", d)
+	}
+}
+
+func TestDetectDesktopWithoutBus(t *testing.T) {
+	t.Setenv("DBUS_SESSION_BUS_ADDRESS", "unix:path="+t.TempDir()+"/missing")
+	t.Setenv("XDG_CURRENT_DESKTOP", "GNOME")
+
+	d, err := DetectDesktop(context.Background())
+	if err == nil {
+		t.Error("DetectDesktop() did not report the missing bus")
+	}
+	if d.Backend != BackendLogind || d.Reason == "" {
+		t.Errorf("Detection = %+v", d)
+	}
+}
+
+func TestDetectDesktopWayland(t *testing.T) {
+	address := startTestBus(t)
+	t.Setenv("DBUS_SESSION_BUS_ADDRESS", address)
+	t.Setenv("XDG_CURRENT_DESKTOP", "XFCE")
+	clearDisplayEnv(t)
+	ctx := context.Background()
+
+	owner := connectTestBus(t, address)
+	requestName(t, owner, "org.xfce.ScreenSaver")
+	requestName(t, owner, "org.freedesktop.ScreenSaver")
+
+	t.Setenv("XDG_SESSION_TYPE", "x11")
+	d, _ := DetectDesktop(ctx)
+	if d.DisplayServer != DisplayServerX11 || d.Service != "org.xfce.ScreenSaver" {
+		t.Errorf("X11: %+v", d)
+	}
+
+	// xfce4-screensaver не работает под Wayland.
+	t.Setenv("XDG_SESSION_TYPE", "wayland")
+	d, _ = DetectDesktop(ctx)
+	if d.DisplayServer != DisplayServerWayland || d.Service != "org.freedesktop.ScreenSaver" {
+		t.Errorf("Wayland: %+v", d)
+	}
+	for _, c := range d.Candidates {
+		if c.Service == "org.xfce.ScreenSaver" && (!c.X11Only || c.Desktop != "") {
+			t.Errorf("Wayland candidate: %+v", c)
+		}
+	}
+}
+
+// fakeScreenSaver emulates the screensaver service described by param.
+type fakeScreenSaver struct {
+	param  paramDBUS
+	conn   *dbus.Conn
+	props  *prop.Properties
+	active atomic.Bool
+}
+
+func (f *fakeScreenSaver) GetActive() (bool, *dbus.Error) {
+	return f.active.Load(), nil
+}
+
+func newFakeScreenSaver(t *testing.T, address string, param paramDBUS) *fakeScreenSaver {
+	t.Helper()
+	f := &fakeScreenSaver{param: param, conn: connectTestBus(t, address)}
+	if param.property != "" {
+		props, err := prop.Export(f.conn, param.path, prop.Map{
+			param.iface: {param.property: {Value: false, Emit: prop.EmitTrue}},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.props = props
+	} else {
+		iface := strings.TrimSuffix(param.getActive, ".GetActive")
+		if err := f.conn.Export(f, param.path, iface); err != nil {
+			t.Fatal(err)
+		}
+	}
+	requestName(t, f.conn, param.dest)
+	return f
+}
+
+func (f *fakeScreenSaver) set(t *testing.T, active bool) {
+	t.Helper()
+	if f.props != nil {
+		f.props.SetMust(f.param.iface, f.param.property, active)
+		return
+	}
+	f.active.Store(active)
+	if err := f.conn.Emit(f.param.path, f.param.iface+"."+f.param.member, active); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDesktopScreenSavers(t *testing.T) {
+	tests := []struct {
+		desktop string
+		service string
+		// path overrides the object path the service is exported at.
+		path    dbus.ObjectPath
+		source  string
+		on, off EventKind
+	}{
+		{"X-Cinnamon", "org.cinnamon.ScreenSaver", "", "org.cinnamon.ScreenSaver.ActiveChanged", EventScreenSaverStart, EventScreenSaverStop},
+		{"XFCE", "org.xfce.ScreenSaver", "", "org.xfce.ScreenSaver.ActiveChanged", EventScreenSaverStart, EventScreenSaverStop},
+		{"LXDE", "org.freedesktop.ScreenSaver", "", "org.freedesktop.ScreenSaver.ActiveChanged", EventScreenSaverStart, EventScreenSaverStop},
+		{"LXQt", "org.freedesktop.ScreenSaver", "", "org.freedesktop.ScreenSaver.ActiveChanged", EventScreenSaverStart, EventScreenSaverStop},
+		{"MATE", "org.mate.ScreenSaver", "", "org.mate.ScreenSaver.ActiveChanged", EventScreenSaverStart, EventScreenSaverStop},
+		{"Budgie:GNOME", "org.buddiesofbudgie.BudgieScreensaver", "", "org.buddiesofbudgie.BudgieScreensaver.ActiveChanged", EventScreenSaverStart, EventScreenSaverStop},
+		{"Pantheon", "org.gnome.ScreenSaver", "", "org.gnome.ScreenSaver.ActiveChanged", EventScreenSaverStart, EventScreenSaverStop},
+		{"Deepin", "com.deepin.SessionManager", "", "com.deepin.SessionManager.Locked", EventLocked, EventUnlocked},
+		// Любой блокировщик по спецификации работает и на неизвестном
+		// рабочем столе, в том числе по пути /ScreenSaver.
+		{"Sway", "org.freedesktop.ScreenSaver", "/ScreenSaver", "org.freedesktop.ScreenSaver.ActiveChanged", EventScreenSaverStart, EventScreenSaverStop},
+	}
+	for _, tt := range tests {
+		t.Run(tt.desktop, func(t *testing.T) {
+			address := startTestBus(t)
+			t.Setenv("DBUS_SESSION_BUS_ADDRESS", address)
+			t.Setenv("XDG_CURRENT_DESKTOP", tt.desktop)
+
+			var param paramDBUS
+			for _, s := range screenSaverServices {
+				if s.param.dest == tt.service {
+					param = s.param
+					break
+				}
+			}
+			if tt.path != "" {
+				param.path = tt.path
+			}
+			fake := newFakeScreenSaver(t, address, param)
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			lock := make(chan Lock, 10)
+			b := NewScreenSaverBackend()
+			if err := New(UseBackend(b)).Subscribe(ctx, lock); err != nil {
+				t.Fatal(err)
+			}
+			if b.param.dest != tt.service {
+				t.Fatalf("detected %q, want %q", b.param.dest, tt.service)
+			}
+			if l := receive(t, lock); !l.Snapshot || l.Kind != tt.off {
+				t.Fatalf("snapshot = %+v, want %s", l, tt.off)
+			}
+
+			fake.set(t, true)
+			l := expectKind(t, lock, tt.on, tt.source)
+			if !l.Lock || l.Backend != BackendDBus {
+				t.Errorf("active: %+v", l)
+			}
+			fake.set(t, false)
+			expectKind(t, lock, tt.off, tt.source)
+		})
+	}
+}
+
+func TestSpoofedSignalsDropped(t *testing.T) {
+	address := startTestBus(t)
+	t.Setenv("DBUS_SESSION_BUS_ADDRESS", address)
+	t.Setenv("XDG_CURRENT_DESKTOP", "GNOME")
+	param := screenSaverServices[0].param
+	fake := newFakeScreenSaver(t, address, param)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	lock := make(chan Lock, 10)
+	if err := New(WithBackend(BackendDBus)).Subscribe(ctx, lock); err != nil {
+		t.Fatal(err)
+	}
+	receive(t, lock)
+
+	spoofer := connectTestBus(t, address)
+	spoof := func(path dbus.ObjectPath) {
+		t.Helper()
+		if err := spoofer.Emit(path, param.iface+"."+param.member, false); err != nil {
+			t.Fatal(err)
+		}
+	}
+	spoof(param.path)
+	fake.set(t, true)
+	expectKind(t, lock, EventScreenSaverStart, "org.gnome.ScreenSaver.ActiveChanged")
+
+	// Служба перезапущена: состояние запрашивается заново, принимаются
+	// сигналы только нового владельца.
+	if _, err := fake.conn.ReleaseName(param.dest); err != nil {
+		t.Fatal(err)
+	}
+	restarted := newFakeScreenSaver(t, address, param)
+	l := expectKind(t, lock, EventScreenSaverStop, "org.gnome.ScreenSaver.GetActive")
+	if !l.Snapshot || !l.Resynced {
+		t.Errorf("after restart: %+v", l)
+	}
+	fake.set(t, false)
+	spoof(param.path)
+	if err := restarted.conn.Emit("/org/gnome/Other", param.iface+"."+param.member, false); err != nil {
+		t.Fatal(err)
+	}
+	restarted.set(t, false)
+	l = expectKind(t, lock, EventScreenSaverStop, "org.gnome.ScreenSaver.ActiveChanged")
+	if l.Snapshot {
+		t.Errorf("got a snapshot: %+v", l)
+	}
+	select {
+	case l := <-lock:
+		t.Errorf("unexpected event %+v", l)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestSignalWatchAccept(t *testing.T) {
+	w := &signalWatch{name: "org.gnome.ScreenSaver", owner: ":1.7", paths: []dbus.ObjectPath{"/org/gnome/ScreenSaver"}}
+	signal := func(sender string, path dbus.ObjectPath) *dbus.Signal {
+		return &dbus.Signal{Sender: sender, Path: path, Name: "org.gnome.ScreenSaver.ActiveChanged", Body: []interface{}{false}}
+	}
+	if !w.accept(signal(":1.7", "/org/gnome/ScreenSaver")) {
+		t.Error("owner rejected")
+	}
+	if w.accept(signal(":1.9", "/org/gnome/ScreenSaver")) {
+		t.Error("spoofed sender accepted")
+	}
+	if w.accept(signal(":1.7", "/org/gnome/Other")) {
+		t.Error("unexpected path accepted")
+	}
+
+	owner := &dbus.Signal{Sender: busName, Name: nameOwnerChanged, Body: []interface{}{"org.gnome.ScreenSaver", ":1.7", ":1.9"}}
+	if tracked, restarted := w.ownerChanged(owner); !tracked || !restarted || w.owner != ":1.9" {
+		t.Errorf("NameOwnerChanged: owner = %q", w.owner)
+	}
+	if !w.accept(signal(":1.9", "/org/gnome/ScreenSaver")) {
+		t.Error("new owner rejected")
+	}
+	forged := &dbus.Signal{Sender: ":1.7", Name: nameOwnerChanged, Body: []interface{}{"org.gnome.ScreenSaver", ":1.9", ":1.7"}}
+	if tracked, _ := w.ownerChanged(forged); tracked || w.accept(forged) || w.owner != ":1.9" {
+		t.Errorf("forged NameOwnerChanged: owner = %q", w.owner)
+	}
+}
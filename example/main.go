@@ -27,7 +27,10 @@ func main() {
 
 	info := make(chan notifyLS.Lock, 10)
 	nl := notifyLS.NotifyLock{}
-	_ = nl.Subscribe(ctx, info)
+	if err := nl.Subscribe(ctx, info); err != nil {
+		fmt.Println("Error subscribe on session events: ", err)
+		return
+	}
 
 	remote, err := notifyLS.IsRemoteSession()
 	if err != nil {
@@ -44,9 +47,9 @@ func main() {
 		select {
 		case l := <-info:
 			if l.Lock {
-				fmt.Println(l.Clock, "Session lock")
+				fmt.Println(l.Clock, "Session lock:", l.Kind, l.Source)
 			} else {
-				fmt.Println(l.Clock, "Session unlock")
+				fmt.Println(l.Clock, "Session unlock:", l.Kind, l.Source)
 			}
 		case <-ctx.Done():
 			slog.Info("End loop lock")
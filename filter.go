@@ -0,0 +1,86 @@
+package notify_lock_session
+
+import "time"
+
+// StateFilter suppresses events that do not change the lock state
+// (Lock.Lock), so a burst of duplicate signals is delivered once.
+type StateFilter struct {
+	// Window delays a transition. When the state returns to the delivered
+	// one within Window, the flap is not delivered at all.
+	Window time.Duration
+	// MinDwell is the minimum time a delivered state is kept before the
+	// next transition is delivered.
+	MinDwell time.Duration
+}
+
+// WithStateFilter filters the events delivered by Subscribe and handlers.
+// Snapshots are always delivered.
+func WithStateFilter(f StateFilter) Option {
+	return func(l *NotifyLock) {
+		l.filter = &f
+	}
+}
+
+// WithRawEvents also sends every event to raw before it is filtered. Events
+// are dropped when raw is full, so a debug consumer cannot stall delivery.
+func WithRawEvents(raw chan<- Lock) Option {
+	return func(l *NotifyLock) {
+		l.raw = raw
+	}
+}
+
+// stateFilter is the running state of a StateFilter.
+type stateFilter struct {
+	StateFilter
+
+	last      Lock
+	hasLast   bool
+	lastAt    time.Time
+	pending   *Lock
+	pendingAt time.Time
+}
+
+// push accepts e at now and returns the events to deliver.
+func (f *stateFilter) push(e Lock, now time.Time) []Lock {
+	if e.Snapshot || !f.hasLast {
+		f.deliver(e, now)
+		return []Lock{e}
+	}
+	if e.Lock == f.last.Lock {
+		// Повтор или возврат к доставленному состоянию внутри окна.
+		f.pending = nil
+		return nil
+	}
+	if f.pending == nil {
+		f.pending, f.pendingAt = &e, now
+	}
+	return f.flush(now)
+}
+
+// due returns when the pending transition is to be delivered.
+func (f *stateFilter) due() (time.Time, bool) {
+	if f.pending == nil {
+		return time.Time{}, false
+	}
+	at := f.pendingAt.Add(f.Window)
+	if dwell := f.lastAt.Add(f.MinDwell); dwell.After(at) {
+		at = dwell
+	}
+	return at, true
+}
+
+// flush delivers the pending transition if it is due at now.
+func (f *stateFilter) flush(now time.Time) []Lock {
+	at, ok := f.due()
+	if !ok || at.After(now) {
+		return nil
+	}
+	e := *f.pending
+	f.deliver(e, now)
+	return []Lock{e}
+}
+
+func (f *stateFilter) deliver(e Lock, now time.Time) {
+	f.last, f.hasLast, f.lastAt = e, true, now
+	f.pending = nil
+}
@@ -0,0 +1,80 @@
+package notify_lock_session_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	notifyLS "github.com/Fast-IQ/notify-lock-session"
+	"github.com/Fast-IQ/notify-lock-session/notifytest"
+)
+
+func subscribeFiltered(t *testing.T, opts ...notifyLS.Option) (*notifytest.Backend, chan notifyLS.Lock) {
+	t.Helper()
+	fake := notifytest.NewBackend()
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	lock := make(chan notifyLS.Lock, 10)
+	nl := notifyLS.New(append(opts, notifyLS.UseBackend(fake))...)
+	if err := nl.Subscribe(ctx, lock); err != nil {
+		t.Fatal(err)
+	}
+	notifytest.ExpectSnapshot(t, lock, false, time.Second)
+	return fake, lock
+}
+
+func emit(t *testing.T, fake *notifytest.Backend, kinds ...notifyLS.EventKind) {
+	t.Helper()
+	for _, kind := range kinds {
+		if err := fake.Emit(kind); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestStateFilterDeduplicates(t *testing.T) {
+	raw := make(chan notifyLS.Lock, 10)
+	fake, lock := subscribeFiltered(t,
+		notifyLS.WithStateFilter(notifyLS.StateFilter{}), notifyLS.WithRawEvents(raw))
+
+	emit(t, fake, notifyLS.EventConsoleDisconnect, notifyLS.EventLocked, notifyLS.EventUnlocked)
+	notifytest.ExpectEvent(t, lock, notifyLS.EventConsoleDisconnect, time.Second)
+	notifytest.ExpectEvent(t, lock, notifyLS.EventUnlocked, time.Second)
+	notifytest.ExpectNoEvent(t, lock, 50*time.Millisecond)
+
+	notifytest.ExpectSnapshot(t, raw, false, time.Second)
+	notifytest.ExpectEvent(t, raw, notifyLS.EventConsoleDisconnect, time.Second)
+	notifytest.ExpectEvent(t, raw, notifyLS.EventLocked, time.Second)
+	notifytest.ExpectEvent(t, raw, notifyLS.EventUnlocked, time.Second)
+}
+
+func TestStateFilterWindow(t *testing.T) {
+	const window = 100 * time.Millisecond
+	fake, lock := subscribeFiltered(t, notifyLS.WithStateFilter(notifyLS.StateFilter{Window: window}))
+
+	// Блокировка и разблокировка внутри окна не доставляются.
+	emit(t, fake, notifyLS.EventLocked, notifyLS.EventUnlocked)
+	notifytest.ExpectNoEvent(t, lock, 2*window)
+
+	start := time.Now()
+	emit(t, fake, notifyLS.EventLocked)
+	notifytest.ExpectEvent(t, lock, notifyLS.EventLocked, time.Second)
+	if d := time.Since(start); d < window {
+		t.Errorf("transition delivered after %s, want at least %s", d, window)
+	}
+}
+
+func TestStateFilterMinDwell(t *testing.T) {
+	const dwell = 100 * time.Millisecond
+	fake, lock := subscribeFiltered(t, notifyLS.WithStateFilter(notifyLS.StateFilter{MinDwell: dwell}))
+	time.Sleep(dwell)
+
+	emit(t, fake, notifyLS.EventLocked)
+	notifytest.ExpectEvent(t, lock, notifyLS.EventLocked, time.Second)
+	start := time.Now()
+	emit(t, fake, notifyLS.EventUnlocked)
+	notifytest.ExpectEvent(t, lock, notifyLS.EventUnlocked, time.Second)
+	if d := time.Since(start); d < dwell/2 {
+		t.Errorf("unlock delivered after %s, want about %s", d, dwell)
+	}
+}
@@ -0,0 +1,139 @@
+package notify_lock_session
+
+import (
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// Handler is called for session events, see NotifyLock.OnChange.
+type Handler func(Event)
+
+// HandlerMode is how the handlers of one event are invoked.
+type HandlerMode int
+
+const (
+	// HandlersOrdered calls the handlers one after another in the order
+	// they were registered.
+	HandlersOrdered HandlerMode = iota
+	// HandlersConcurrent calls the handlers in parallel. The next event is
+	// dispatched after all of them return or time out.
+	HandlersConcurrent
+)
+
+// WithHandlerMode sets how handlers are invoked, HandlersOrdered by default.
+func WithHandlerMode(mode HandlerMode) Option {
+	return func(l *NotifyLock) {
+		l.handlerMode = mode
+	}
+}
+
+// WithHandlerTimeout stops waiting for a handler after d. The handler keeps
+// running, but no longer holds up the following handlers and events.
+func WithHandlerTimeout(d time.Duration) Option {
+	return func(l *NotifyLock) {
+		l.handlerTimeout = d
+	}
+}
+
+type handlerEntry struct {
+	id     uint64
+	match  func(Event) bool
+	handle Handler
+}
+
+// OnLock registers h for events that leave the session locked (Event.Lock
+// is true). It returns a function that removes the handler.
+func (l *NotifyLock) OnLock(h Handler) (remove func()) {
+	return l.addHandler(func(e Event) bool { return e.Lock }, h)
+}
+
+// OnUnlock registers h for events that leave the session unlocked.
+func (l *NotifyLock) OnUnlock(h Handler) (remove func()) {
+	return l.addHandler(func(e Event) bool { return !e.Lock }, h)
+}
+
+// OnChange registers h for every event, including the initial snapshot.
+func (l *NotifyLock) OnChange(h Handler) (remove func()) {
+	return l.addHandler(func(Event) bool { return true }, h)
+}
+
+func (l *NotifyLock) addHandler(match func(Event) bool, h Handler) func() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.nextID++
+	id := l.nextID
+	l.handlers = append(l.handlers, &handlerEntry{id: id, match: match, handle: h})
+
+	return func() {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		for i, entry := range l.handlers {
+			if entry.id == id {
+				l.handlers = append(l.handlers[:i:i], l.handlers[i+1:]...)
+				return
+			}
+		}
+	}
+}
+
+// dispatch invokes the handlers matching e.
+func (l *NotifyLock) dispatch(e Event) {
+	l.mu.Lock()
+	var handlers []Handler
+	for _, entry := range l.handlers {
+		if entry.match(e) {
+			handlers = append(handlers, entry.handle)
+		}
+	}
+	l.mu.Unlock()
+
+	if l.handlerMode == HandlersConcurrent {
+		var wg sync.WaitGroup
+		for _, h := range handlers {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				l.invoke(h, e)
+			}()
+		}
+		wg.Wait()
+		return
+	}
+	for _, h := range handlers {
+		l.invoke(h, e)
+	}
+}
+
+// invoke calls h, recovering a panic and waiting at most the handler
+// timeout.
+func (l *NotifyLock) invoke(h Handler, e Event) {
+	call := func() {
+		defer func() {
+			if r := recover(); r != nil {
+				slog.Error("Session handler panic", slog.String("event", e.Kind.String()),
+					slog.Any("error", fmt.Errorf("%v", r)))
+			}
+		}()
+		h(e)
+	}
+	if l.handlerTimeout <= 0 {
+		call()
+		return
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		call()
+	}()
+	timer := time.NewTimer(l.handlerTimeout)
+	defer timer.Stop()
+	select {
+	case <-done:
+	case <-timer.C:
+		slog.Warn("Session handler timed out", slog.String("event", e.Kind.String()),
+			slog.Duration("timeout", l.handlerTimeout))
+	}
+}
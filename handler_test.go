@@ -0,0 +1,129 @@
+package notify_lock_session_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	notifyLS "github.com/Fast-IQ/notify-lock-session"
+	"github.com/Fast-IQ/notify-lock-session/notifytest"
+)
+
+// recorder collects the names of the handlers in the order they ran.
+type recorder struct {
+	mu    sync.Mutex
+	calls []string
+	seen  chan string
+}
+
+func newRecorder() *recorder {
+	return &recorder{seen: make(chan string, 100)}
+}
+
+func (r *recorder) handler(name string) notifyLS.Handler {
+	return func(e notifyLS.Event) {
+		r.mu.Lock()
+		r.calls = append(r.calls, name+":"+e.Kind.String())
+		r.mu.Unlock()
+		r.seen <- name
+	}
+}
+
+func (r *recorder) wait(t *testing.T, n int) []string {
+	t.Helper()
+	for i := 0; i < n; i++ {
+		select {
+		case <-r.seen:
+		case <-time.After(time.Second):
+			t.Fatalf("only %d of %d handler calls", i, n)
+		}
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string(nil), r.calls...)
+}
+
+func TestHandlersOrdered(t *testing.T) {
+	fake := notifytest.NewBackend()
+	nl := notifyLS.New(notifyLS.UseBackend(fake))
+	rec := newRecorder()
+	nl.OnChange(rec.handler("change"))
+	nl.OnLock(func(notifyLS.Event) { panic("broken handler") })
+	nl.OnLock(rec.handler("lock"))
+	removeUnlock := nl.OnUnlock(rec.handler("unlock"))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := nl.Subscribe(ctx, nil); err != nil {
+		t.Fatal(err)
+	}
+	calls := rec.wait(t, 2)
+	if calls[0] != "change:unlocked" || calls[1] != "unlock:unlocked" {
+		t.Errorf("snapshot calls = %q", calls)
+	}
+
+	if err := fake.Lock(); err != nil {
+		t.Fatal(err)
+	}
+	calls = rec.wait(t, 2)
+	if calls[2] != "change:locked" || calls[3] != "lock:locked" {
+		t.Errorf("lock calls = %q", calls)
+	}
+
+	removeUnlock()
+	if err := fake.Unlock(); err != nil {
+		t.Fatal(err)
+	}
+	calls = rec.wait(t, 1)
+	select {
+	case name := <-rec.seen:
+		t.Errorf("removed handler still called: %s", name)
+	case <-time.After(50 * time.Millisecond):
+	}
+	if calls[4] != "change:unlocked" {
+		t.Errorf("unlock calls = %q", calls)
+	}
+}
+
+func TestHandlerTimeout(t *testing.T) {
+	fake := notifytest.NewBackend()
+	nl := notifyLS.New(notifyLS.UseBackend(fake), notifyLS.WithHandlerTimeout(20*time.Millisecond))
+	release := make(chan struct{})
+	defer close(release)
+	rec := newRecorder()
+	nl.OnChange(func(notifyLS.Event) { <-release })
+	nl.OnChange(rec.handler("next"))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := nl.Subscribe(ctx, nil); err != nil {
+		t.Fatal(err)
+	}
+	rec.wait(t, 1)
+}
+
+func TestHandlersConcurrent(t *testing.T) {
+	fake := notifytest.NewBackend()
+	nl := notifyLS.New(notifyLS.UseBackend(fake), notifyLS.WithHandlerMode(notifyLS.HandlersConcurrent))
+
+	// Оба обработчика должны работать одновременно, иначе первый не дождётся второго.
+	var started sync.WaitGroup
+	started.Add(2)
+	rec := newRecorder()
+	for _, name := range []string{"a", "b"} {
+		h := rec.handler(name)
+		nl.OnChange(func(e notifyLS.Event) {
+			started.Done()
+			started.Wait()
+			h(e)
+		})
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := nl.Subscribe(ctx, nil); err != nil {
+		t.Fatal(err)
+	}
+	rec.wait(t, 2)
+}
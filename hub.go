@@ -0,0 +1,355 @@
+package notify_lock_session
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ErrHubStarted is returned by Hub.Start when the hub is already running.
+var ErrHubStarted = errors.New("hub is already started")
+
+// Hub owns one subscription to the backends of a NotifyLock and broadcasts
+// its events to any number of consumers.
+type Hub struct {
+	nl *NotifyLock
+
+	mu      sync.Mutex
+	started bool
+	// stopped is set once the hub has run and stopped, until the next Start.
+	stopped bool
+	subs    map[*Subscription]struct{}
+	last    Lock
+	hasLast bool
+}
+
+// NewHub returns a hub for nl. Call Start to begin watching.
+func NewHub(nl *NotifyLock) *Hub {
+	return &Hub{
+		nl:   nl,
+		subs: map[*Subscription]struct{}{},
+	}
+}
+
+// Start subscribes to the backends and broadcasts their events until ctx
+// is done. All subscriptions are closed when the hub stops.
+func (h *Hub) Start(ctx context.Context) error {
+	h.mu.Lock()
+	if h.started {
+		h.mu.Unlock()
+		return ErrHubStarted
+	}
+	h.started = true
+	h.stopped = false
+	h.mu.Unlock()
+
+	events := make(chan Lock, 16)
+	if err := h.nl.Subscribe(ctx, events); err != nil {
+		h.mu.Lock()
+		h.started = false
+		h.mu.Unlock()
+		return err
+	}
+
+	go func() {
+		defer h.closeAll()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case l, ok := <-events:
+				if !ok {
+					return
+				}
+				h.broadcast(ctx, l)
+			}
+		}
+	}()
+	return nil
+}
+
+// Err returns the runtime error of the underlying NotifyLock.
+func (h *Hub) Err() error {
+	return h.nl.Err()
+}
+
+func (h *Hub) broadcast(ctx context.Context, l Lock) {
+	h.mu.Lock()
+	h.last, h.hasLast = l, true
+	subs := make([]*Subscription, 0, len(h.subs))
+	for s := range h.subs {
+		subs = append(subs, s)
+	}
+	h.mu.Unlock()
+
+	for _, s := range subs {
+		s.deliver(ctx, l)
+	}
+}
+
+func (h *Hub) closeAll() {
+	h.mu.Lock()
+	subs := h.subs
+	h.subs = map[*Subscription]struct{}{}
+	h.started = false
+	h.stopped = true
+	h.mu.Unlock()
+
+	for s := range subs {
+		s.close()
+	}
+}
+
+// Subscribe adds a consumer. A consumer joining a running hub first
+// receives the last known state as a snapshot. Once the hub has stopped,
+// the returned subscription is already closed.
+func (h *Hub) Subscribe(opts ...SubscriptionOption) *Subscription {
+	s := &Subscription{
+		hub:    h,
+		buffer: 16,
+		done:   make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	if s.policy != DeliverBlock && s.buffer == 0 {
+		// Без очереди отбрасывать или объединять нечего.
+		s.buffer = 1
+	}
+	s.in = make(chan Lock, s.buffer)
+	s.out = make(chan Lock)
+
+	h.mu.Lock()
+	if h.stopped {
+		h.mu.Unlock()
+		s.close()
+		go s.run()
+		return s
+	}
+	h.subs[s] = struct{}{}
+	if h.hasLast && (s.filter == nil || s.filter(h.last)) {
+		first := h.last
+		first.Snapshot = true
+		s.first = &first
+	}
+	h.mu.Unlock()
+
+	go s.run()
+	if s.ctx != nil {
+		go func() {
+			select {
+			case <-s.ctx.Done():
+				h.Unsubscribe(s)
+			case <-s.done:
+			}
+		}()
+	}
+	return s
+}
+
+// Unsubscribe removes s and closes its channel.
+func (h *Hub) Unsubscribe(s *Subscription) {
+	h.mu.Lock()
+	delete(h.subs, s)
+	h.mu.Unlock()
+	s.close()
+}
+
+// SubscriptionOption configures a Subscription.
+type SubscriptionOption func(*Subscription)
+
+// WithBuffer sets the number of events queued for a slow consumer.
+func WithBuffer(n int) SubscriptionOption {
+	return func(s *Subscription) {
+		if n >= 0 {
+			s.buffer = n
+		}
+	}
+}
+
+// WithFilter delivers only the events for which filter returns true.
+func WithFilter(filter func(Lock) bool) SubscriptionOption {
+	return func(s *Subscription) {
+		s.filter = filter
+	}
+}
+
+// WithContext unsubscribes when ctx is done.
+func WithContext(ctx context.Context) SubscriptionOption {
+	return func(s *Subscription) {
+		s.ctx = ctx
+	}
+}
+
+// DeliveryPolicy decides what happens to an event when the queue of a
+// slow consumer is full.
+type DeliveryPolicy int
+
+const (
+	// DeliverBlock waits for the consumer, holding up the hub.
+	DeliverBlock DeliveryPolicy = iota
+	// DeliverBlockTimeout waits up to the block timeout, then drops the event.
+	DeliverBlockTimeout
+	// DeliverDropOldest drops the oldest queued event to make room.
+	DeliverDropOldest
+	// DeliverDropNewest drops the new event.
+	DeliverDropNewest
+	// DeliverCoalesce replaces the queued events with the new one, so the
+	// consumer always catches up with the latest state.
+	DeliverCoalesce
+)
+
+// WithDelivery sets the delivery policy, DeliverBlock by default.
+func WithDelivery(policy DeliveryPolicy) SubscriptionOption {
+	return func(s *Subscription) {
+		s.policy = policy
+	}
+}
+
+// WithBlockTimeout selects DeliverBlockTimeout with the timeout d.
+func WithBlockTimeout(d time.Duration) SubscriptionOption {
+	return func(s *Subscription) {
+		s.policy = DeliverBlockTimeout
+		s.timeout = d
+	}
+}
+
+// DeliveryStats are the counters of a subscription.
+type DeliveryStats struct {
+	Delivered uint64
+	Dropped   uint64
+	Coalesced uint64
+}
+
+// Subscription is one consumer of a Hub.
+type Subscription struct {
+	hub     *Hub
+	buffer  int
+	filter  func(Lock) bool
+	ctx     context.Context
+	policy  DeliveryPolicy
+	timeout time.Duration
+
+	delivered atomic.Uint64
+	dropped   atomic.Uint64
+	coalesced atomic.Uint64
+
+	// first is the snapshot sent before any queued event.
+	first *Lock
+	in    chan Lock
+	out   chan Lock
+	done  chan struct{}
+	once  sync.Once
+}
+
+// C returns the channel of events. It is closed by Unsubscribe and when
+// the hub stops.
+func (s *Subscription) C() <-chan Lock {
+	return s.out
+}
+
+// Close is a shortcut for Hub.Unsubscribe.
+func (s *Subscription) Close() {
+	s.hub.Unsubscribe(s)
+}
+
+func (s *Subscription) close() {
+	s.once.Do(func() { close(s.done) })
+}
+
+// Stats returns the delivery counters of s.
+func (s *Subscription) Stats() DeliveryStats {
+	return DeliveryStats{
+		Delivered: s.delivered.Load(),
+		Dropped:   s.dropped.Load(),
+		Coalesced: s.coalesced.Load(),
+	}
+}
+
+func (s *Subscription) deliver(ctx context.Context, l Lock) {
+	if s.filter != nil && !s.filter(l) {
+		return
+	}
+
+	switch s.policy {
+	case DeliverBlockTimeout:
+		timer := time.NewTimer(s.timeout)
+		defer timer.Stop()
+		select {
+		case s.in <- l:
+		case <-timer.C:
+			s.dropped.Add(1)
+		case <-s.done:
+		case <-ctx.Done():
+		}
+	case DeliverDropNewest:
+		select {
+		case s.in <- l:
+		default:
+			s.dropped.Add(1)
+		}
+	case DeliverDropOldest:
+		for {
+			select {
+			case s.in <- l:
+				return
+			default:
+			}
+			select {
+			case <-s.in:
+				s.dropped.Add(1)
+			default:
+			}
+		}
+	case DeliverCoalesce:
+		for {
+			select {
+			case s.in <- l:
+				return
+			default:
+			}
+			for drained := false; !drained; {
+				select {
+				case <-s.in:
+					s.coalesced.Add(1)
+				default:
+					drained = true
+				}
+			}
+		}
+	default:
+		select {
+		case s.in <- l:
+		case <-s.done:
+		case <-ctx.Done():
+		}
+	}
+}
+
+// run moves queued events to the consumer until the subscription is closed.
+func (s *Subscription) run() {
+	defer close(s.out)
+	if s.first != nil {
+		select {
+		case s.out <- *s.first:
+			s.delivered.Add(1)
+		case <-s.done:
+			return
+		}
+	}
+	for {
+		select {
+		case <-s.done:
+			return
+		case l := <-s.in:
+			select {
+			case s.out <- l:
+				s.delivered.Add(1)
+			case <-s.done:
+				return
+			}
+		}
+	}
+}
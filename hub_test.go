@@ -0,0 +1,156 @@
+package notify_lock_session_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	notifyLS "github.com/Fast-IQ/notify-lock-session"
+	"github.com/Fast-IQ/notify-lock-session/notifytest"
+)
+
+func TestHubBroadcast(t *testing.T) {
+	fake := notifytest.NewBackend()
+	hub := notifyLS.NewHub(notifyLS.New(notifyLS.UseBackend(fake)))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	all := hub.Subscribe()
+	locks := hub.Subscribe(notifyLS.WithFilter(func(l notifyLS.Lock) bool { return l.Lock }))
+	if err := hub.Start(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := hub.Start(ctx); err == nil {
+		t.Error("second Start() succeeded")
+	}
+
+	notifytest.ExpectSnapshot(t, all.C(), false, time.Second)
+	if err := fake.Lock(); err != nil {
+		t.Fatal(err)
+	}
+	notifytest.ExpectEvent(t, all.C(), notifyLS.EventLocked, time.Second)
+	notifytest.ExpectEvent(t, locks.C(), notifyLS.EventLocked, time.Second)
+
+	// Новый подписчик сразу получает последнее состояние.
+	late := hub.Subscribe()
+	if l := notifytest.ExpectSnapshot(t, late.C(), true, time.Second); l.Kind != notifyLS.EventLocked {
+		t.Errorf("late snapshot = %+v", l)
+	}
+
+	hub.Unsubscribe(all)
+	if _, ok := <-all.C(); ok {
+		t.Error("channel is open after Unsubscribe")
+	}
+	if err := fake.Unlock(); err != nil {
+		t.Fatal(err)
+	}
+	notifytest.ExpectEvent(t, late.C(), notifyLS.EventUnlocked, time.Second)
+	notifytest.ExpectNoEvent(t, locks.C(), 50*time.Millisecond)
+
+	cancel()
+	select {
+	case _, ok := <-late.C():
+		if ok {
+			t.Error("unexpected event after stop")
+		}
+	case <-time.After(time.Second):
+		t.Error("subscription is open after the hub stopped")
+	}
+}
+
+func TestHubSubscriptionContext(t *testing.T) {
+	fake := notifytest.NewBackend()
+	hub := notifyLS.NewHub(notifyLS.New(notifyLS.UseBackend(fake)))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := hub.Start(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	subCtx, subCancel := context.WithCancel(ctx)
+	s := hub.Subscribe(notifyLS.WithContext(subCtx), notifyLS.WithBuffer(1))
+	subCancel()
+	select {
+	case <-s.C():
+	case <-time.After(time.Second):
+		t.Fatal("subscription is open after its context was cancelled")
+	}
+}
+
+func TestHubSubscribeAfterStop(t *testing.T) {
+	fake := notifytest.NewBackend()
+	hub := notifyLS.NewHub(notifyLS.New(notifyLS.UseBackend(fake)))
+	ctx, cancel := context.WithCancel(context.Background())
+	early := hub.Subscribe()
+	if err := hub.Start(ctx); err != nil {
+		t.Fatal(err)
+	}
+	cancel()
+	for range early.C() {
+	}
+
+	s := hub.Subscribe()
+	select {
+	case _, ok := <-s.C():
+		if ok {
+			t.Error("event on a subscription of a stopped hub")
+		}
+	case <-time.After(time.Second):
+		t.Error("subscription of a stopped hub is open")
+	}
+}
+
+func TestDeliveryPolicies(t *testing.T) {
+	script := []notifyLS.EventKind{notifyLS.EventLocked, notifyLS.EventUnlocked,
+		notifyLS.EventLocked, notifyLS.EventUnlocked, notifyLS.EventLogoff}
+
+	tests := []struct {
+		name   string
+		opt    notifyLS.SubscriptionOption
+		second notifyLS.EventKind
+		stats  notifyLS.DeliveryStats
+	}{
+		{"drop-newest", notifyLS.WithDelivery(notifyLS.DeliverDropNewest),
+			notifyLS.EventLocked, notifyLS.DeliveryStats{Delivered: 2, Dropped: 4}},
+		{"drop-oldest", notifyLS.WithDelivery(notifyLS.DeliverDropOldest),
+			notifyLS.EventLogoff, notifyLS.DeliveryStats{Delivered: 2, Dropped: 4}},
+		{"coalesce", notifyLS.WithDelivery(notifyLS.DeliverCoalesce),
+			notifyLS.EventLogoff, notifyLS.DeliveryStats{Delivered: 2, Coalesced: 4}},
+		{"block-timeout", notifyLS.WithBlockTimeout(10 * time.Millisecond),
+			notifyLS.EventLocked, notifyLS.DeliveryStats{Delivered: 2, Dropped: 4}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := notifytest.NewBackend()
+			hub := notifyLS.NewHub(notifyLS.New(notifyLS.UseBackend(fake)))
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			// Снимок ждёт потребителя, в очереди помещается одно событие.
+			slow := hub.Subscribe(tt.opt, notifyLS.WithBuffer(1))
+			if err := hub.Start(ctx); err != nil {
+				t.Fatal(err)
+			}
+			time.Sleep(50 * time.Millisecond)
+			for _, kind := range script {
+				if err := fake.Emit(kind); err != nil {
+					t.Fatal(err)
+				}
+			}
+			deadline := time.Now().Add(time.Second)
+			for st := slow.Stats(); st.Dropped+st.Coalesced < 4; st = slow.Stats() {
+				if time.Now().After(deadline) {
+					t.Fatalf("stats = %+v", st)
+				}
+				time.Sleep(5 * time.Millisecond)
+			}
+
+			notifytest.ExpectSnapshot(t, slow.C(), false, time.Second)
+			notifytest.ExpectEvent(t, slow.C(), tt.second, time.Second)
+			notifytest.ExpectNoEvent(t, slow.C(), 20*time.Millisecond)
+			if st := slow.Stats(); st != tt.stats {
+				t.Errorf("stats = %+v, want %+v", st, tt.stats)
+			}
+		})
+	}
+}
@@ -0,0 +1,192 @@
+//go:build linux
+
+package notify_lock_session
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+
+	"github.com/godbus/dbus/v5"
+)
+
+const (
+	logindDest         = "org.freedesktop.login1"
+	logindPath         = "/org/freedesktop/login1"
+	logindManagerIface = "org.freedesktop.login1.Manager"
+	logindSessionIface = "org.freedesktop.login1.Session"
+	logindUserIface    = "org.freedesktop.login1.User"
+
+	// logindAutoSession resolves to the caller's session, or to the
+	// user's display session when the caller has none.
+	logindAutoSession = "/org/freedesktop/login1/session/auto"
+
+	propertiesIface   = "org.freedesktop.DBus.Properties"
+	propertiesChanged = propertiesIface + ".PropertiesChanged"
+)
+
+// logindSessionPath returns the object path of the caller's logind session.
+func logindSessionPath(ctx context.Context, conn *dbus.Conn) dbus.ObjectPath {
+	manager := conn.Object(logindDest, logindPath)
+	getSession := func(id string) (path dbus.ObjectPath, err error) {
+		err = manager.CallWithContext(ctx, logindManagerIface+".GetSession", 0, id).Store(&path)
+		return path, err
+	}
+
+	if id := os.Getenv("XDG_SESSION_ID"); id != "" {
+		if path, err := getSession(id); err == nil {
+			return path
+		}
+	}
+	var path dbus.ObjectPath
+	err := manager.CallWithContext(ctx, logindManagerIface+".GetSessionByPID", 0, uint32(os.Getpid())).Store(&path)
+	if err == nil {
+		return path
+	}
+	// Сигналы приходят с настоящего пути сессии, а не с "auto".
+	if v, err := conn.Object(logindDest, logindAutoSession).GetProperty(logindSessionIface + ".Id"); err == nil {
+		if id, ok := v.Value().(string); ok {
+			if path, err := getSession(id); err == nil {
+				return path
+			}
+		}
+	}
+	return logindAutoSession
+}
+
+// logindUserSession returns the display session of the user uid.
+func logindUserSession(ctx context.Context, conn *dbus.Conn, uid int) (dbus.ObjectPath, error) {
+	var user dbus.ObjectPath
+	err := conn.Object(logindDest, logindPath).CallWithContext(ctx, logindManagerIface+".GetUser", 0, uint32(uid)).Store(&user)
+	if err != nil {
+		return "", err
+	}
+	var display struct {
+		ID   string
+		Path dbus.ObjectPath
+	}
+	err = conn.Object(logindDest, user).StoreProperty(logindUserIface+".Display", &display)
+	if err != nil {
+		return "", err
+	}
+	if display.ID == "" {
+		return "", fmt.Errorf("user %d has no display session", uid)
+	}
+	return display.Path, nil
+}
+
+// LogindBackend watches the Lock/Unlock signals and LockedHint of the
+// caller's systemd-logind session on the system bus.
+type LogindBackend struct {
+	baseBackend
+	// bus is set by WithBus, with UserBus the display session of that
+	// user is watched.
+	bus string
+}
+
+func NewLogindBackend() *LogindBackend {
+	return &LogindBackend{}
+}
+
+func (b *LogindBackend) Name() string { return BackendLogind }
+
+func (b *LogindBackend) setBus(bus string) { b.bus = bus }
+
+// sessionPath returns the session selected by WithBus, the caller's session
+// otherwise.
+func (b *LogindBackend) sessionPath(ctx context.Context, conn *dbus.Conn) dbus.ObjectPath {
+	if uid, ok := busUser(b.bus); ok && uid >= 0 {
+		path, err := logindUserSession(ctx, conn, uid)
+		if err == nil {
+			return path
+		}
+		slog.Warn("Display session of user", slog.Int("uid", uid), slog.Any("error", err))
+	}
+	return logindSessionPath(ctx, conn)
+}
+
+func (b *LogindBackend) Capabilities() Capability { return CapLock | CapState }
+
+func (b *LogindBackend) State(ctx context.Context) (Lock, error) {
+	conn, err := connectBus("system")
+	if err != nil {
+		return Lock{}, err
+	}
+	defer func() { _ = conn.Close() }()
+
+	return logindLockedHint(conn, b.sessionPath(ctx, conn))
+}
+
+func logindLockedHint(conn *dbus.Conn, path dbus.ObjectPath) (Lock, error) {
+	v, err := conn.Object(logindDest, path).GetProperty(logindSessionIface + ".LockedHint")
+	if err != nil {
+		return Lock{}, err
+	}
+	locked, _ := v.Value().(bool)
+	return newSnapshot(lockedKind(locked), BackendLogind, logindSessionIface+".LockedHint"), nil
+}
+
+func (b *LogindBackend) Start(ctx context.Context, events chan<- Lock) error {
+	var path dbus.ObjectPath
+	w := &signalWatch{
+		dial:  func() (*dbus.Conn, error) { return connectBus("system") },
+		event: logindEvent,
+		name:  logindDest,
+	}
+	w.subscribe = func(ctx context.Context, conn *dbus.Conn) error {
+		path = b.sessionPath(ctx, conn)
+		w.paths = []dbus.ObjectPath{path}
+		err := conn.AddMatchSignal(
+			dbus.WithMatchSender(logindDest),
+			dbus.WithMatchObjectPath(path),
+			dbus.WithMatchInterface(logindSessionIface),
+		)
+		if err == nil {
+			err = conn.AddMatchSignal(
+				dbus.WithMatchSender(logindDest),
+				dbus.WithMatchObjectPath(path),
+				dbus.WithMatchInterface(propertiesIface),
+				dbus.WithMatchMember("PropertiesChanged"),
+				dbus.WithMatchArg(0, logindSessionIface),
+			)
+		}
+		if err != nil {
+			return fmt.Errorf("subscribe on logind session %s: %w", path, err)
+		}
+		return nil
+	}
+	w.state = func(ctx context.Context, conn *dbus.Conn) (Lock, error) {
+		return logindLockedHint(conn, path)
+	}
+	if err := w.open(ctx); err != nil {
+		return err
+	}
+	go w.run(b.watch(ctx), events, b.setErr)
+	return nil
+}
+
+// logindEvent maps the Lock/Unlock signals and LockedHint changes of a
+// logind session.
+func logindEvent(s *dbus.Signal) (Lock, bool) {
+	switch s.Name {
+	case logindSessionIface + ".Lock":
+		return newLock(EventLocked, BackendLogind, s.Name), true
+	case logindSessionIface + ".Unlock":
+		return newLock(EventUnlocked, BackendLogind, s.Name), true
+	case propertiesChanged:
+		if len(s.Body) < 2 {
+			return Lock{}, false
+		}
+		changed, ok := s.Body[1].(map[string]dbus.Variant)
+		if !ok {
+			return Lock{}, false
+		}
+		if v, ok := changed["LockedHint"]; ok {
+			if locked, ok := v.Value().(bool); ok {
+				return newLock(lockedKind(locked), BackendLogind, logindSessionIface+".LockedHint"), true
+			}
+		}
+	}
+	return Lock{}, false
+}
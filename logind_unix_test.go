@@ -0,0 +1,293 @@
+//go:build linux
+
+package notify_lock_session
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+	"github.com/godbus/dbus/v5/prop"
+)
+
+const (
+	testSessionPath  = dbus.ObjectPath("/org/freedesktop/login1/session/c1")
+	testUserPath     = dbus.ObjectPath("/org/freedesktop/login1/user/_1000")
+	testSession2Path = dbus.ObjectPath("/org/freedesktop/login1/session/c2")
+)
+
+var (
+	testSeat = struct {
+		ID   string
+		Path dbus.ObjectPath
+	}{"seat0", "/org/freedesktop/login1/seat/seat0"}
+	testUser = struct {
+		UID  uint32
+		Path dbus.ObjectPath
+	}{1000, testUserPath}
+	testLogonTime = time.Date(2026, 10, 18, 9, 0, 0, 0, time.UTC)
+)
+
+// fakeLogind emulates the parts of org.freedesktop.login1 used by the
+// logind backend for a single session "c1".
+type fakeLogind struct {
+	conn  *dbus.Conn
+	props *prop.Properties
+}
+
+type fakeLogindManager struct{}
+
+func (fakeLogindManager) GetSession(id string) (dbus.ObjectPath, *dbus.Error) {
+	if id != "c1" {
+		return "", dbus.NewError("org.freedesktop.login1.NoSuchSession", []interface{}{id})
+	}
+	return testSessionPath, nil
+}
+
+func (fakeLogindManager) GetUser(uid uint32) (dbus.ObjectPath, *dbus.Error) {
+	if uid != 1000 {
+		return "", dbus.NewError("org.freedesktop.login1.NoSuchUser", []interface{}{uid})
+	}
+	return testUserPath, nil
+}
+
+// ListSessions lists c1 and c2, c2 is exported only by the tests that need
+// a second session.
+func (fakeLogindManager) ListSessions() ([]logindSession, *dbus.Error) {
+	return []logindSession{
+		{"c1", 1000, "alice", "seat0", testSessionPath},
+		{"c2", 1001, "bob", "", testSession2Path},
+	}, nil
+}
+
+func (fakeLogindManager) GetSessionByPID(pid uint32) (dbus.ObjectPath, *dbus.Error) {
+	return testSessionPath, nil
+}
+
+func newFakeLogind(t *testing.T, address string) *fakeLogind {
+	t.Helper()
+	conn := connectTestBus(t, address)
+	err := conn.Export(fakeLogindManager{}, logindPath, logindManagerIface)
+	if err != nil {
+		t.Fatal(err)
+	}
+	props, err := prop.Export(conn, testSessionPath, prop.Map{
+		logindSessionIface: {
+			"Id":         {Value: "c1", Emit: prop.EmitFalse},
+			"Name":       {Value: "alice", Emit: prop.EmitFalse},
+			"User":       {Value: testUser, Emit: prop.EmitFalse},
+			"Seat":       {Value: testSeat, Emit: prop.EmitFalse},
+			"Type":       {Value: "x11", Emit: prop.EmitFalse},
+			"Class":      {Value: "user", Emit: prop.EmitFalse},
+			"Timestamp":  {Value: uint64(testLogonTime.UnixMicro()), Emit: prop.EmitFalse},
+			"Remote":     {Value: false, Emit: prop.EmitFalse},
+			"RemoteHost": {Value: "", Emit: prop.EmitFalse},
+			"Service":    {Value: "gdm-password", Emit: prop.EmitFalse},
+			"Active":     {Value: true, Emit: prop.EmitFalse},
+			"LockedHint": {Value: false, Emit: prop.EmitTrue},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	display := struct {
+		ID   string
+		Path dbus.ObjectPath
+	}{"c1", testSessionPath}
+	_, err = prop.Export(conn, testUserPath, prop.Map{
+		logindUserIface: {"Display": {Value: display, Emit: prop.EmitFalse}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	requestName(t, conn, logindDest)
+	return &fakeLogind{conn: conn, props: props}
+}
+
+func (f *fakeLogind) setLockedHint(locked bool) {
+	f.props.SetMust(logindSessionIface, "LockedHint", locked)
+}
+
+func (f *fakeLogind) emit(t *testing.T, member string) {
+	t.Helper()
+	if err := f.conn.Emit(testSessionPath, logindSessionIface+"."+member); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// emitManager emits a signal of the logind manager.
+func (f *fakeLogind) emitManager(t *testing.T, member string, args ...interface{}) {
+	t.Helper()
+	if err := f.conn.Emit(logindPath, logindManagerIface+"."+member, args...); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLogindBackend(t *testing.T) {
+	address := startTestBus(t)
+	t.Setenv("DBUS_SYSTEM_BUS_ADDRESS", address)
+	t.Setenv("XDG_SESSION_ID", "c1")
+	fake := newFakeLogind(t, address)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	lock := make(chan Lock, 10)
+	if err := New(WithBackend(BackendLogind)).Subscribe(ctx, lock); err != nil {
+		t.Fatal(err)
+	}
+
+	l := expectKind(t, lock, EventUnlocked, logindSessionIface+".LockedHint")
+	if !l.Snapshot || l.Backend != BackendLogind {
+		t.Errorf("initial event: %+v", l)
+	}
+
+	fake.setLockedHint(true)
+	l = expectKind(t, lock, EventLocked, logindSessionIface+".LockedHint")
+	if !l.Lock || l.Snapshot {
+		t.Errorf("LockedHint event: %+v", l)
+	}
+
+	fake.emit(t, "Unlock")
+	expectKind(t, lock, EventUnlocked, logindSessionIface+".Unlock")
+	fake.emit(t, "Lock")
+	expectKind(t, lock, EventLocked, logindSessionIface+".Lock")
+}
+
+func TestLogindState(t *testing.T) {
+	address := startTestBus(t)
+	t.Setenv("DBUS_SYSTEM_BUS_ADDRESS", address)
+	t.Setenv("XDG_SESSION_ID", "")
+	fake := newFakeLogind(t, address)
+	fake.setLockedHint(true)
+
+	l, err := New(WithBackend(BackendLogind)).State(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if l.Kind != EventLocked || !l.Snapshot {
+		t.Errorf("State() = %+v", l)
+	}
+}
+
+func TestAutoBackendFallsBackToLogind(t *testing.T) {
+	address := startTestBus(t)
+	t.Setenv("DBUS_SESSION_BUS_ADDRESS", address)
+	t.Setenv("XDG_CURRENT_DESKTOP", "")
+
+	b, err := defaultBackends(context.Background(), "")
+	if err != nil || len(b) != 1 || b[0].Name() != BackendLogind {
+		t.Errorf("defaultBackends() = %v, %v, want %q", b, err, BackendLogind)
+	}
+
+	requestName(t, connectTestBus(t, address), "org.gnome.ScreenSaver")
+	b, err = defaultBackends(context.Background(), "")
+	if err != nil || len(b) != 1 || b[0].Name() != BackendDBus {
+		t.Fatalf("defaultBackends() = %v, %v, want %q", b, err, BackendDBus)
+	}
+	// Найденный сервис передан бэкенду, повторного определения нет.
+	if param := b[0].(*ScreenSaverBackend).param; param == nil || param.dest != "org.gnome.ScreenSaver" {
+		t.Errorf("param = %+v", param)
+	}
+}
+
+func TestSubscribeSetupError(t *testing.T) {
+	t.Setenv("DBUS_SYSTEM_BUS_ADDRESS", "unix:path="+t.TempDir()+"/missing")
+
+	nl := New(WithBackend(BackendLogind))
+	if err := nl.Subscribe(context.Background(), make(chan Lock, 1)); err == nil {
+		t.Fatal("Subscribe() succeeded without a bus")
+	}
+}
+
+func TestSubscribeRuntimeError(t *testing.T) {
+	address, daemon := startTestBusProcess(t)
+	t.Setenv("DBUS_SYSTEM_BUS_ADDRESS", address)
+	t.Setenv("XDG_SESSION_ID", "c1")
+	newFakeLogind(t, address)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	lock := make(chan Lock, 10)
+	nl := New(WithBackend(BackendLogind))
+	if err := nl.Subscribe(ctx, lock); err != nil {
+		t.Fatal(err)
+	}
+	receive(t, lock)
+	if err := nl.Err(); err != nil {
+		t.Fatalf("Err() = %v while watching", err)
+	}
+
+	_ = daemon.Process.Kill()
+	deadline := time.Now().Add(5 * time.Second)
+	for nl.Err() == nil {
+		if time.Now().After(deadline) {
+			t.Fatal("Err() did not report the closed connection")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestReconnect(t *testing.T) {
+	dir := t.TempDir()
+	address, daemon := startTestBusIn(t, dir)
+	t.Setenv("DBUS_SYSTEM_BUS_ADDRESS", address)
+	t.Setenv("XDG_SESSION_ID", "c1")
+	newFakeLogind(t, address)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	lock := make(chan Lock, 10)
+	nl := New(WithBackend(BackendLogind))
+	if err := nl.Subscribe(ctx, lock); err != nil {
+		t.Fatal(err)
+	}
+	receive(t, lock)
+
+	_ = daemon.Process.Kill()
+	_ = daemon.Wait()
+	deadline := time.Now().Add(5 * time.Second)
+	for nl.Err() == nil {
+		if time.Now().After(deadline) {
+			t.Fatal("Err() did not report the closed connection")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// Шина вернулась, пока сеанс был заблокирован.
+	startTestBusIn(t, dir)
+	fake := newFakeLogind(t, address)
+	fake.setLockedHint(true)
+
+	l := expectKind(t, lock, EventLocked, logindSessionIface+".LockedHint")
+	if !l.Snapshot || !l.Resynced {
+		t.Errorf("after reconnect: %+v", l)
+	}
+	if err := nl.Err(); err != nil {
+		t.Errorf("Err() = %v after reconnect", err)
+	}
+	fake.emit(t, "Unlock")
+	expectKind(t, lock, EventUnlocked, logindSessionIface+".Unlock")
+}
+
+func TestLogindUserSession(t *testing.T) {
+	address := startTestBus(t)
+	t.Setenv("DBUS_SYSTEM_BUS_ADDRESS", address)
+	t.Setenv("XDG_SESSION_ID", "")
+	fake := newFakeLogind(t, address)
+	conn := connectTestBus(t, address)
+
+	path, err := logindUserSession(context.Background(), conn, 1000)
+	if err != nil || path != testSessionPath {
+		t.Fatalf("logindUserSession(1000) = %q, %v", path, err)
+	}
+	if _, err = logindUserSession(context.Background(), conn, 1001); err == nil {
+		t.Error("logindUserSession(1001) found a session")
+	}
+
+	fake.setLockedHint(true)
+	l, err := New(WithBus(UserBus(1000)), WithBackend(BackendLogind)).State(context.Background())
+	if err != nil || l.Kind != EventLocked {
+		t.Errorf("State() = %+v, %v", l, err)
+	}
+}
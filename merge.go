@@ -0,0 +1,133 @@
+package notify_lock_session
+
+// MergePolicy decides the lock state when several backends report it.
+type MergePolicy int
+
+const (
+	// MergeNone passes the events of all backends through.
+	MergeNone MergePolicy = iota
+	// MergeFirstWins applies the first report of a new state; the same
+	// state reported later by other backends is dropped.
+	MergeFirstWins
+	// MergePriority follows the backend with the highest priority that
+	// has reported a state. Backends missing from the priority list come
+	// last, between them the first report wins.
+	MergePriority
+	// MergeRequireAgreement changes the state only when all backends that
+	// have reported agree.
+	MergeRequireAgreement
+	// MergeLogindAuthoritative follows logind once it has reported a
+	// state, the other backends decide first-wins until then.
+	MergeLogindAuthoritative
+)
+
+// WithMerge runs the events of the selected backends through policy, so
+// Subscribe delivers one consistent state stream. Backend and Source of a
+// delivered event name the backend that decided it. priority lists backend
+// names for MergePriority, highest first.
+func WithMerge(policy MergePolicy, priority ...string) Option {
+	return func(l *NotifyLock) {
+		l.merge = &merger{policy: policy, priority: priority}
+	}
+}
+
+// merger is the running state of a MergePolicy. States are tracked per
+// Lock.Backend.
+type merger struct {
+	policy   MergePolicy
+	priority []string
+
+	states  map[string]Lock
+	current Lock
+	known   bool
+}
+
+// reset returns a copy of m without state for a new subscription.
+func (m *merger) reset() *merger {
+	return &merger{policy: m.policy, priority: m.priority, states: map[string]Lock{}}
+}
+
+// snapshot records the initial states and returns the merged one. When the
+// backends disagree and the policy does not settle it, locked wins.
+func (m *merger) snapshot(states []Lock) (Lock, bool) {
+	for _, s := range states {
+		m.states[s.Backend] = s
+	}
+	var (
+		d  Lock
+		ok bool
+	)
+	switch m.policy {
+	case MergePriority:
+		d, ok = m.byPriority()
+	case MergeLogindAuthoritative:
+		d, ok = m.states[BackendLogind]
+	}
+	if !ok {
+		d, ok = lockedFirst(states)
+	}
+	if ok {
+		m.current, m.known = d, true
+	}
+	return d, ok
+}
+
+// push records e and returns the event to deliver, ok is false when the
+// merged state does not change.
+func (m *merger) push(e Lock) (Lock, bool) {
+	m.states[e.Backend] = e
+	d, ok := m.decide(e)
+	if !ok || (d.Backend != e.Backend && m.known) {
+		// Решает другой источник, его состояние уже доставлено.
+		return Lock{}, false
+	}
+	if m.known && d.Lock == m.current.Lock && !d.Snapshot {
+		return Lock{}, false
+	}
+	m.current, m.known = d, true
+	return d, true
+}
+
+func (m *merger) decide(e Lock) (Lock, bool) {
+	switch m.policy {
+	case MergePriority:
+		if s, ok := m.byPriority(); ok {
+			return s, true
+		}
+	case MergeRequireAgreement:
+		for _, s := range m.states {
+			if s.Lock != e.Lock {
+				return Lock{}, false
+			}
+		}
+	case MergeLogindAuthoritative:
+		if s, ok := m.states[BackendLogind]; ok {
+			return s, true
+		}
+	}
+	return e, true
+}
+
+// byPriority returns the state of the listed backend with the highest
+// priority, ok is false when none of them has reported.
+func (m *merger) byPriority() (Lock, bool) {
+	for _, name := range m.priority {
+		if s, ok := m.states[name]; ok {
+			return s, true
+		}
+	}
+	return Lock{}, false
+}
+
+// lockedFirst returns the first locked state, otherwise the first state.
+func lockedFirst(states []Lock) (Lock, bool) {
+	for _, s := range states {
+		if s.Lock {
+			return s, true
+		}
+	}
+	if len(states) == 0 {
+		return Lock{}, false
+	}
+	return states[0], true
+}
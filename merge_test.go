@@ -0,0 +1,95 @@
+package notify_lock_session
+
+import (
+	"context"
+	"testing"
+)
+
+func TestMergePolicies(t *testing.T) {
+	ev := func(backend string, locked bool) Lock {
+		return newLock(lockedKind(locked), backend, "test")
+	}
+	// step is an event and the backend expected to decide it, "" when the
+	// event is dropped.
+	type step struct {
+		in      Lock
+		decided string
+	}
+	tests := []struct {
+		name     string
+		policy   MergePolicy
+		priority []string
+		steps    []step
+	}{
+		{"first-wins", MergeFirstWins, nil, []step{
+			{ev("dbus", true), "dbus"},
+			{ev(BackendLogind, true), ""},
+			{ev(BackendLogind, false), BackendLogind},
+			{ev("dbus", false), ""},
+		}},
+		{"priority", MergePriority, []string{"dbus", BackendLogind}, []step{
+			{ev(BackendLogind, true), ""},
+			{ev("dbus", true), "dbus"},
+			{ev(BackendLogind, false), ""},
+			{ev("signal", false), ""},
+			{ev("dbus", false), "dbus"},
+		}},
+		{"agreement", MergeRequireAgreement, nil, []step{
+			{ev(BackendLogind, true), ""},
+			{ev("dbus", true), "dbus"},
+			{ev("dbus", false), ""},
+			{ev(BackendLogind, false), BackendLogind},
+			{ev("signal", true), ""},
+		}},
+		{"logind-authoritative", MergeLogindAuthoritative, nil, []step{
+			{ev("dbus", false), ""},
+			{ev(BackendLogind, true), BackendLogind},
+			{ev("dbus", false), ""},
+			{ev(BackendLogind, false), BackendLogind},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := (&merger{policy: tt.policy, priority: tt.priority}).reset()
+			// Начальное состояние: обе системы сообщают о разблокировке.
+			if s, ok := m.snapshot([]Lock{ev(BackendLogind, false), ev("dbus", false)}); !ok || s.Lock {
+				t.Fatalf("snapshot = %+v", s)
+			}
+			for i, st := range tt.steps {
+				out, ok := m.push(st.in)
+				switch {
+				case st.decided == "" && ok:
+					t.Errorf("step %d: %s %v delivered", i, st.in.Backend, st.in.Lock)
+				case st.decided != "" && (!ok || out.Backend != st.decided || out.Lock != st.in.Lock):
+					t.Errorf("step %d: got %+v, %v, want %v decided by %s", i, out, ok, st.in.Lock, st.decided)
+				}
+			}
+		})
+	}
+}
+
+func TestMergedSubscribe(t *testing.T) {
+	a := newStubBackend(BackendLogind, true)
+	b := newStubBackend("dbus", false)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	lock := make(chan Lock)
+	nl := New(UseBackend(a, b), WithMerge(MergeLogindAuthoritative))
+	if err := nl.Subscribe(ctx, lock); err != nil {
+		t.Fatal(err)
+	}
+	if l := nextLock(t, lock); !l.Snapshot || !l.Lock || l.Backend != BackendLogind {
+		t.Errorf("snapshot = %+v", l)
+	}
+
+	b.in <- newLock(EventUnlocked, "dbus", "stub")
+	a.in <- newLock(EventUnlocked, BackendLogind, "stub")
+	if l := nextLock(t, lock); l.Lock || l.Backend != BackendLogind {
+		t.Errorf("merged = %+v", l)
+	}
+
+	if l, err := nl.State(ctx); err != nil || l.Backend != BackendLogind {
+		t.Errorf("State() = %+v, %v", l, err)
+	}
+}
@@ -1,11 +1,360 @@
 package notify_lock_session
 
-import "time"
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+)
 
 type NotifyLock struct {
+	names     []string
+	instances []Backend
+	bus       string
+
+	handlerMode    HandlerMode
+	handlerTimeout time.Duration
+
+	filter *StateFilter
+	raw    chan<- Lock
+	merge  *merger
+
+	// errs are the configuration errors of the options.
+	errs []error
+
+	mu       sync.Mutex
+	running  []Backend
+	handlers []*handlerEntry
+	nextID   uint64
+}
+
+// ErrUnknownBackend is returned when the selected backend is not available
+// on this platform.
+var ErrUnknownBackend = errors.New("unknown backend")
+
+// Option configures a NotifyLock created by New.
+type Option func(*NotifyLock)
+
+// New returns a NotifyLock configured with opts. The zero NotifyLock is
+// equivalent to New().
+func New(opts ...Option) *NotifyLock {
+	l := &NotifyLock{}
+	for _, opt := range opts {
+		opt(l)
+	}
+	return l
+}
+
+// WithBackend selects registered backends by name (BackendDBus,
+// BackendLogind, ...). Events of all selected backends are combined.
+// Without any selection the platform default is picked automatically.
+func WithBackend(names ...string) Option {
+	return func(l *NotifyLock) {
+		for _, name := range names {
+			if name != "" {
+				l.names = append(l.names, name)
+			}
+		}
+	}
+}
+
+// UseBackend adds backend instances that are not in the registry.
+func UseBackend(backends ...Backend) Option {
+	return func(l *NotifyLock) {
+		l.instances = append(l.instances, backends...)
+	}
+}
+
+// Subscribe starts the selected backends and sends their events to lock
+// until ctx is done. It returns once all backends are listening; the first
+// event is always a snapshot of the current state. lock may be nil when
+// the events are only consumed by handlers.
+func (l *NotifyLock) Subscribe(ctx context.Context, lock chan Lock) error {
+	backends, err := l.backends(ctx)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	events := make(chan Lock, 16)
+	for i, b := range backends {
+		if err := b.Start(ctx, events); err != nil {
+			cancel()
+			stopBackends(backends[:i])
+			return fmt.Errorf("%s: %w", b.Name(), err)
+		}
+	}
+	l.mu.Lock()
+	l.running = backends
+	l.mu.Unlock()
+
+	go l.pump(ctx, cancel, backends, events, lock)
+	return nil
+}
+
+// pump delivers the snapshot and then the events of the backends through
+// the merge policy and the state filter until ctx is done.
+func (l *NotifyLock) pump(ctx context.Context, cancel context.CancelFunc, backends []Backend, events chan Lock, lock chan Lock) {
+	defer stopBackends(backends)
+	defer cancel()
+
+	filter := &stateFilter{}
+	if l.filter != nil {
+		filter.StateFilter = *l.filter
+	}
+	merge := l.merger()
+	timer := time.NewTimer(time.Hour)
+	timer.Stop()
+	defer timer.Stop()
+
+	deliver := func(out []Lock) bool {
+		for _, e := range out {
+			if !l.emit(ctx, lock, e) {
+				return false
+			}
+		}
+		if at, ok := filter.due(); ok {
+			timer.Reset(time.Until(at))
+		}
+		return true
+	}
+
+	// События копятся в events, поэтому снимок всегда первый. Без CapState
+	// (например, logind-sessions) снимка нет.
+	if hasCapability(backends, CapState) {
+		if state, err := mergedState(ctx, backends, merge); err != nil {
+			slog.Warn("Initial session state", slog.Any("error", err))
+		} else {
+			l.sendRaw(state)
+			if !deliver(filter.push(state, time.Now())) {
+				return
+			}
+		}
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case e := <-events:
+			l.sendRaw(e)
+			if merge != nil {
+				var ok bool
+				if e, ok = merge.push(e); !ok {
+					continue
+				}
+			}
+			out := []Lock{e}
+			if l.filter != nil {
+				out = filter.push(e, time.Now())
+			}
+			if !deliver(out) {
+				return
+			}
+		case <-timer.C:
+			if !deliver(filter.flush(time.Now())) {
+				return
+			}
+		}
+	}
+}
+
+func (l *NotifyLock) sendRaw(e Lock) {
+	if l.raw == nil {
+		return
+	}
+	select {
+	case l.raw <- e:
+	default:
+	}
+}
+
+// merger returns a fresh merger for the policy of WithMerge, nil when the
+// events are passed through.
+func (l *NotifyLock) merger() *merger {
+	if l.merge == nil || l.merge.policy == MergeNone {
+		return nil
+	}
+	return l.merge.reset()
+}
+
+// mergedState is stateOf decided by merge when it is not nil.
+func mergedState(ctx context.Context, backends []Backend, merge *merger) (Lock, error) {
+	if merge == nil {
+		return stateOf(ctx, backends)
+	}
+	states, err := statesOf(ctx, backends)
+	if err != nil {
+		return Lock{}, err
+	}
+	state, _ := merge.snapshot(states)
+	return state, nil
 }
 
+// State returns the current state of the session as reported by the
+// selected backends. A locked state wins over an unlocked one unless
+// WithMerge decides otherwise.
+func (l *NotifyLock) State(ctx context.Context) (Lock, error) {
+	backends, err := l.backends(ctx)
+	if err != nil {
+		return Lock{}, err
+	}
+	return mergedState(ctx, backends, l.merger())
+}
+
+// Err returns the errors that stopped backends after Subscribe returned,
+// or that they are recovering from, nil while the session is being watched.
+func (l *NotifyLock) Err() error {
+	l.mu.Lock()
+	running := l.running
+	l.mu.Unlock()
+
+	var errs []error
+	for _, b := range running {
+		if err := b.Err(); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", b.Name(), err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// emit runs the handlers for e and sends it to lock.
+func (l *NotifyLock) emit(ctx context.Context, lock chan Lock, e Lock) bool {
+	l.dispatch(e)
+	if lock == nil {
+		return ctx.Err() == nil
+	}
+	return send(ctx, lock, e)
+}
+
+func stopBackends(backends []Backend) {
+	for _, b := range backends {
+		if err := b.Stop(); err != nil {
+			slog.Error("Stop backend", slog.String("backend", b.Name()), slog.Any("error", err))
+		}
+	}
+}
+
+// send delivers l to lock unless ctx is done first.
+func send(ctx context.Context, lock chan<- Lock, l Lock) bool {
+	select {
+	case lock <- l:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// EventKind is the kind of session change reported by a backend.
+type EventKind int
+
+const (
+	EventUnknown EventKind = iota
+	EventLocked
+	EventUnlocked
+	EventLogon
+	EventLogoff
+	EventRemoteConnect
+	EventRemoteDisconnect
+	EventConsoleConnect
+	EventConsoleDisconnect
+	EventSessionCreate
+	EventSessionTerminate
+	EventScreenSaverStart
+	EventScreenSaverStop
+)
+
+var eventKindNames = map[EventKind]string{
+	EventUnknown:           "unknown",
+	EventLocked:            "locked",
+	EventUnlocked:          "unlocked",
+	EventLogon:             "logon",
+	EventLogoff:            "logoff",
+	EventRemoteConnect:     "remote-connect",
+	EventRemoteDisconnect:  "remote-disconnect",
+	EventConsoleConnect:    "console-connect",
+	EventConsoleDisconnect: "console-disconnect",
+	EventSessionCreate:     "session-create",
+	EventSessionTerminate:  "session-terminate",
+	EventScreenSaverStart:  "screensaver-start",
+	EventScreenSaverStop:   "screensaver-stop",
+}
+
+func (k EventKind) String() string {
+	if s, ok := eventKindNames[k]; ok {
+		return s
+	}
+	return "unknown"
+}
+
+// Locked reports whether the session should be treated as locked after an
+// event of this kind. It keeps the meaning of the old Lock.Lock flag.
+func (k EventKind) Locked() bool {
+	switch k {
+	case EventLocked,
+		EventLogoff,
+		EventRemoteDisconnect,
+		EventConsoleDisconnect,
+		EventSessionTerminate,
+		EventScreenSaverStart:
+		return true
+	}
+	return false
+}
+
+func lockedKind(locked bool) EventKind {
+	if locked {
+		return EventLocked
+	}
+	return EventUnlocked
+}
+
+// Backend names reported in Lock.Backend.
+const (
+	BackendDBus        = "dbus"
+	BackendLogind      = "logind"
+	BackendWTS         = "wts"
+	BackendNSWorkspace = "nsworkspace"
+)
+
+// Event is the name the handler API uses for Lock.
+type Event = Lock
+
 type Lock struct {
+	// Lock is derived from Kind and kept for compatibility.
 	Lock  bool
 	Clock time.Time
+	Kind  EventKind
+	// Source is the raw notification the event was mapped from,
+	// e.g. "WTS_SESSION_LOCK" or "org.gnome.ScreenSaver.ActiveChanged".
+	Source string
+	// Backend is the name of the backend that produced the event.
+	Backend string
+	// Snapshot marks the current state queried by State rather than a
+	// transition. Subscribe sends one snapshot before any transitions.
+	Snapshot bool
+	// Resynced marks a snapshot queried after the backend reconnected or
+	// the watched service restarted: transitions may have been missed
+	// before it.
+	Resynced bool
+	// Session is the session of the event when the backend watches all
+	// sessions of the machine, nil otherwise.
+	Session *SessionRef
+}
+
+func newLock(kind EventKind, backend, source string) Lock {
+	return Lock{
+		Lock:    kind.Locked(),
+		Clock:   time.Now(),
+		Kind:    kind,
+		Source:  source,
+		Backend: backend,
+	}
+}
+
+func newSnapshot(kind EventKind, backend, source string) Lock {
+	l := newLock(kind, backend, source)
+	l.Snapshot = true
+	return l
 }
@@ -5,85 +5,255 @@
 package notify_lock_session
 
 /*
-#cgo LDFLAGS: -framework Foundation -framework AppKit
+#cgo CFLAGS: -x objective-c
+#cgo LDFLAGS: -framework Foundation -framework AppKit -framework CoreGraphics
 #include <Foundation/Foundation.h>
 #include <AppKit/AppKit.h>
+#include <CoreGraphics/CoreGraphics.h>
 
-// Функция для добавления наблюдателя
-void addObserver() {
-    // Создаем объект NSNotificationCenter
-    NSNotificationCenter *center = [NSNotificationCenter defaultCenter];
+#define NOTE_SESSION_ACTIVE     0
+#define NOTE_SESSION_RESIGN     1
+#define NOTE_SCREEN_LOCKED      2
+#define NOTE_SCREEN_UNLOCKED    3
+#define NOTE_SCREENSAVER_START  4
+#define NOTE_SCREENSAVER_STOP   5
 
-    // Добавляем наблюдателя на уведомления о блокировке экрана (система)
-    [center addObserverForName:NSWorkspaceSessionDidBecomeActiveNotification
-                        object:nil
-                         queue:nil
-                    usingBlock:^(NSNotification *note) {
-						relayMessage(0)
-                        NSLog(@"Сессия стала активной!");
-                    }];
+extern void relayMessage(unsigned int note);
 
-    // Добавляем наблюдателя на другие уведомления (например, уход в режим сна)
-    [center addObserverForName:NSWorkspaceSessionDidResignActiveNotification
+static inline void observe(NSNotificationCenter *center, NSString *name, unsigned int note) {
+    [center addObserverForName:name
                         object:nil
                          queue:nil
-                    usingBlock:^(NSNotification *note) {
-						relayMessage(1)
-                        NSLog(@"Сессия была заблокирована или завершена!");
+                    usingBlock:^(NSNotification *n) {
+                        relayMessage(note);
                     }];
 }
 
+// Функция для добавления наблюдателя
+static inline void addObserver() {
+    @autoreleasepool {
+        // Переключение пользователей (система)
+        NSNotificationCenter *workspace = [[NSWorkspace sharedWorkspace] notificationCenter];
+        observe(workspace, NSWorkspaceSessionDidBecomeActiveNotification, NOTE_SESSION_ACTIVE);
+        observe(workspace, NSWorkspaceSessionDidResignActiveNotification, NOTE_SESSION_RESIGN);
+
+        // Блокировка экрана и заставка
+        NSNotificationCenter *distributed = [NSDistributedNotificationCenter defaultCenter];
+        observe(distributed, @"com.apple.screenIsLocked", NOTE_SCREEN_LOCKED);
+        observe(distributed, @"com.apple.screenIsUnlocked", NOTE_SCREEN_UNLOCKED);
+        observe(distributed, @"com.apple.screensaver.didstart", NOTE_SCREENSAVER_START);
+        observe(distributed, @"com.apple.screensaver.didstop", NOTE_SCREENSAVER_STOP);
+    }
+}
+
+// Цикл обработки уведомлений на текущем потоке, не возвращается.
+static inline void runLoop() {
+    NSRunLoop *loop = [NSRunLoop currentRunLoop];
+    // Без источников runMode сразу возвращает NO.
+    [loop addPort:[NSMachPort port] forMode:NSDefaultRunLoopMode];
+    for (;;) {
+        @autoreleasepool {
+            [loop runMode:NSDefaultRunLoopMode beforeDate:[NSDate distantFuture]];
+        }
+    }
+}
+
+// Текущее состояние: 1 - заблокирован, 0 - нет, -1 - нет данных о сессии
+static inline int screenIsLocked() {
+    CFDictionaryRef session = CGSessionCopyCurrentDictionary();
+    if (session == NULL) {
+        return -1;
+    }
+    CFBooleanRef locked = CFDictionaryGetValue(session, CFSTR("CGSSessionScreenIsLocked"));
+    int res = (locked != NULL && CFBooleanGetValue(locked)) ? 1 : 0;
+    CFRelease(session);
+    return res;
+}
+
 */
 
 import "C"
 import (
 	"context"
-	"time"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os/exec"
+	"os/user"
+	"runtime"
+	"strings"
+	"sync"
 )
 
-var messages = make(chan bool)
+// nsBackends are the started backends the notifications are relayed to.
+var (
+	nsBackendsMu sync.Mutex
+	nsBackends   = map[*NSWorkspaceBackend]struct{}{}
+)
 
+// relayMessage queues the event for every started backend without waiting,
+// so a slow consumer never stalls the run loop.
+//
 //export relayMessage
-func (l *NotifyLock) relayMessage(lock C.uint) {
-	messages <- lock != 0
+func relayMessage(note C.uint) {
+	kind, source, ok := noteEventKind(note)
+	if !ok {
+		return
+	}
+	l := newLock(kind, BackendNSWorkspace, source)
+	nsBackendsMu.Lock()
+	defer nsBackendsMu.Unlock()
+	for b := range nsBackends {
+		select {
+		case b.messages <- l:
+		default:
+			slog.Warn("Session message queue is full, message dropped", slog.String("source", source))
+		}
+	}
+}
+
+// noteEventKind maps the notifications observed in addObserver.
+func noteEventKind(note C.uint) (kind EventKind, source string, ok bool) {
+	switch note {
+	case C.NOTE_SESSION_ACTIVE:
+		return EventConsoleConnect, "NSWorkspaceSessionDidBecomeActiveNotification", true
+	case C.NOTE_SESSION_RESIGN:
+		return EventConsoleDisconnect, "NSWorkspaceSessionDidResignActiveNotification", true
+	case C.NOTE_SCREEN_LOCKED:
+		return EventLocked, "com.apple.screenIsLocked", true
+	case C.NOTE_SCREEN_UNLOCKED:
+		return EventUnlocked, "com.apple.screenIsUnlocked", true
+	case C.NOTE_SCREENSAVER_START:
+		return EventScreenSaverStart, "com.apple.screensaver.didstart", true
+	case C.NOTE_SCREENSAVER_STOP:
+		return EventScreenSaverStop, "com.apple.screensaver.didstop", true
+	}
+	return EventUnknown, "", false
+}
+
+func init() {
+	Register(BackendNSWorkspace, func() (Backend, error) { return NewNSWorkspaceBackend(), nil })
 }
 
-func (l *NotifyLock) Subscribe(ctx context.Context, lock chan Lock) error {
+func defaultBackends(ctx context.Context, bus string) ([]Backend, error) {
+	return []Backend{NewNSWorkspaceBackend()}, nil
+}
+
+// Наблюдатели добавляются один раз на процесс.
+var observeOnce sync.Once
+
+// startObservers adds the observers on a dedicated OS thread and runs its
+// run loop, which delivers the notifications.
+func startObservers() {
+	ready := make(chan struct{})
 	go func() {
+		// Поток занят циклом до конца процесса.
+		runtime.LockOSThread()
 		C.addObserver()
+		close(ready)
+		C.runLoop()
+	}()
+	<-ready
+}
+
+// NSWorkspaceBackend observes the workspace session and the distributed
+// screen lock and screensaver notifications.
+type NSWorkspaceBackend struct {
+	baseBackend
+	messages chan Lock
+}
+
+func NewNSWorkspaceBackend() *NSWorkspaceBackend {
+	return &NSWorkspaceBackend{messages: make(chan Lock, 100)}
+}
+
+func (b *NSWorkspaceBackend) Name() string { return BackendNSWorkspace }
+
+func (b *NSWorkspaceBackend) Capabilities() Capability {
+	return CapLock | CapScreenSaver | CapSession | CapState
+}
+
+func (b *NSWorkspaceBackend) Start(ctx context.Context, events chan<- Lock) error {
+	observeOnce.Do(startObservers)
+	ctx = b.watch(ctx)
+	nsBackendsMu.Lock()
+	nsBackends[b] = struct{}{}
+	nsBackendsMu.Unlock()
+	go func() {
+		defer func() {
+			nsBackendsMu.Lock()
+			delete(nsBackends, b)
+			nsBackendsMu.Unlock()
+		}()
 		for {
 			select {
-			case m <- messages:
-				l := Lock{
-					Lock:  m,
-					Clock: time.Now(),
+			case m := <-b.messages:
+				if !send(ctx, events, m) {
+					return
 				}
 			case <-ctx.Done():
 				return
 			}
 		}
-	}
+	}()
 	return nil
 }
 
+// State returns the current lock state of the console session.
+func (b *NSWorkspaceBackend) State(ctx context.Context) (Lock, error) {
+	switch C.screenIsLocked() {
+	case 1:
+		return newSnapshot(EventLocked, BackendNSWorkspace, "CGSSessionScreenIsLocked"), nil
+	case 0:
+		return newSnapshot(EventUnlocked, BackendNSWorkspace, "CGSSessionScreenIsLocked"), nil
+	}
+	return Lock{}, errors.New("no console session")
+}
+
 func IsRemoteSession() (bool, error) {
+	r, err := DetectRemoteSession()
+	return r.Remote, err
+}
+
+// DetectRemoteSession looks for open connections on the VNC, SSH and Apple
+// Remote Desktop ports.
+func DetectRemoteSession() (RemoteSession, error) {
 	out, err := exec.Command("lsof", "-i").Output()
 	if err != nil {
-		return false, error.New("Ошибка при выполнении команды lsof:", err)
-
+		return RemoteSession{}, fmt.Errorf("Ошибка при выполнении команды lsof: %w", err)
 	}
 
+	ports := []struct{ port, protocol string }{
+		{":5900", "vnc"}, // Порт VNC
+		{":22", "ssh"},   // Порт SSH
+		{":3283", "ard"}, // Порт ARD
+	}
 	lines := strings.Split(string(out), "\n")
 	for _, line := range lines {
-		if strings.Contains(line, ":5900") { // Порт VNC
-			return true, nil
-		}
-		if strings.Contains(line, ":22") { // Порт SSH
-			return true, nil
-		}
-		if strings.Contains(line, ":3283") { // Порт ARD
-			return true, nil
+		for _, p := range ports {
+			if strings.Contains(line, p.port) {
+				return RemoteSession{Remote: true, Protocol: p.protocol, Evidence: []string{"lsof " + p.port}}, nil
+			}
 		}
 	}
-	return false, nil
+	return RemoteSession{Evidence: []string{"lsof"}}, nil
+}
+
+// CurrentSession describes the session of the caller. macOS reports only the
+// user.
+func CurrentSession() (SessionInfo, error) {
+	u, err := user.Current()
+	if err != nil {
+		return SessionInfo{}, err
+	}
+	return SessionInfo{User: u.Username}, nil
+}
+
+// ListSessions returns the session of the caller only.
+func ListSessions() ([]SessionInfo, error) {
+	info, err := CurrentSession()
+	if err != nil {
+		return nil, err
+	}
+	return []SessionInfo{info}, nil
 }
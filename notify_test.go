@@ -0,0 +1,26 @@
+package notify_lock_session
+
+import "testing"
+
+func TestEventKindLocked(t *testing.T) {
+	locked := []EventKind{EventLocked, EventLogoff, EventRemoteDisconnect,
+		EventConsoleDisconnect, EventSessionTerminate, EventScreenSaverStart}
+	unlocked := []EventKind{EventUnknown, EventUnlocked, EventLogon, EventRemoteConnect,
+		EventConsoleConnect, EventSessionCreate, EventScreenSaverStop}
+	for _, k := range locked {
+		if !k.Locked() {
+			t.Errorf("%s: want locked", k)
+		}
+		if l := newLock(k, "", ""); !l.Lock {
+			t.Errorf("%s: Lock flag not derived", k)
+		}
+	}
+	for _, k := range unlocked {
+		if k.Locked() {
+			t.Errorf("%s: want unlocked", k)
+		}
+	}
+	if s := EventKind(100).String(); s != "unknown" {
+		t.Errorf("String() = %q", s)
+	}
+}
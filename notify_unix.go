@@ -5,100 +5,233 @@ package notify_lock_session
 import (
 	"context"
 	"fmt"
+
 	"github.com/godbus/dbus/v5"
-	"os"
-	"time"
 )
 
 type paramDBUS struct {
-	iface  string
-	member string
+	dest string
+	path dbus.ObjectPath
+	// altPaths are tried by the state query when path is not exported.
+	altPaths []dbus.ObjectPath
+	iface    string
+	member   string
+	// getActive is the method returning the current screensaver state.
+	getActive string
+	// property is a boolean property of iface used instead of member and
+	// getActive: changes arrive by PropertiesChanged, the state is read
+	// with Get.
+	property string
+	// locks is set when the source reports the lock itself rather than
+	// the screensaver.
+	locks bool
 }
 
-func (l *NotifyLock) Subscribe(ctx context.Context, lock chan Lock) (e error) {
-	go func() {
-		// Подключение к системе D-Bus
-		conn, err := dbus.ConnectSessionBus()
-		if err != nil {
-			return err
+// kind maps the boolean state reported by the source.
+func (p paramDBUS) kind(active bool) EventKind {
+	if p.locks {
+		return lockedKind(active)
+	}
+	return screenSaverKind(active)
+}
+
+// matchOptions are the match rules for the signals of the source.
+func (p paramDBUS) matchOptions() []dbus.MatchOption {
+	if p.property != "" {
+		return []dbus.MatchOption{
+			dbus.WithMatchSender(p.dest),
+			dbus.WithMatchObjectPath(p.path),
+			dbus.WithMatchInterface(propertiesIface),
+			dbus.WithMatchMember("PropertiesChanged"),
+			dbus.WithMatchArg(0, p.iface),
 		}
-		defer func() { _ = conn.Close() }()
-		param := l.getDbusParams()
-		// Подписка на события
-		err = conn.AddMatchSignal(
-			dbus.WithMatchInterface(param.iface),
-			dbus.WithMatchMember(param.member),
-		)
-		if err != nil {
-			return err
-			//log.Fatalf("Error subscribe on event: %v", err)
-			//return err
+	}
+	opts := []dbus.MatchOption{
+		dbus.WithMatchInterface(p.iface),
+		dbus.WithMatchMember(p.member),
+	}
+	if p.dest != "" {
+		opts = append(opts, dbus.WithMatchSender(p.dest))
+	}
+	return opts
+}
+
+// paths are the object paths the signals of the source come from.
+func (p paramDBUS) paths() []dbus.ObjectPath {
+	if p.path == "" {
+		return nil
+	}
+	return append([]dbus.ObjectPath{p.path}, p.altPaths...)
+}
+
+// decode maps a received signal, ok is false for unrelated signals.
+func (p paramDBUS) decode(s *dbus.Signal) (l Lock, ok bool) {
+	if p.property == "" {
+		if s.Name != p.iface+"."+p.member || len(s.Body) == 0 {
+			return Lock{}, false
 		}
+		active, ok := s.Body[0].(bool)
+		if !ok {
+			return Lock{}, false
+		}
+		return newLock(p.kind(active), BackendDBus, s.Name), true
+	}
+
+	if s.Name != propertiesChanged || s.Path != p.path || len(s.Body) < 2 {
+		return Lock{}, false
+	}
+	if iface, _ := s.Body[0].(string); iface != p.iface {
+		return Lock{}, false
+	}
+	changed, _ := s.Body[1].(map[string]dbus.Variant)
+	v, ok := changed[p.property]
+	if !ok {
+		return Lock{}, false
+	}
+	active, ok := v.Value().(bool)
+	if !ok {
+		return Lock{}, false
+	}
+	return newLock(p.kind(active), BackendDBus, p.iface+"."+p.property), true
+}
 
-		// Канал для получения сигналов
-		var signals = make(chan *dbus.Signal, 10)
-		conn.Signal(signals)
-
-		for {
-			select {
-			case <-ctx.Done():
-				return
-			case s := <-signals:
-				if len(s.Body) > 0 {
-					state, ok := s.Body[0].(bool)
-					if ok {
-						l := Lock{
-							Lock:  state,
-							Clock: time.Now(),
-						}
-						lock <- l
-					}
-				}
+// state queries the current state of the source.
+func (p paramDBUS) state(ctx context.Context, conn *dbus.Conn) (Lock, error) {
+	obj := conn.Object(p.dest, p.path)
+	var active bool
+	switch {
+	case p.property != "":
+		v, err := obj.GetProperty(p.iface + "." + p.property)
+		if err != nil {
+			return Lock{}, err
+		}
+		active, ok := v.Value().(bool)
+		if !ok {
+			return Lock{}, fmt.Errorf("%s.%s: unexpected type %s", p.iface, p.property, v.Signature())
+		}
+		return newSnapshot(p.kind(active), BackendDBus, p.iface+"."+p.property), nil
+	case p.getActive != "":
+		err := obj.CallWithContext(ctx, p.getActive, 0).Store(&active)
+		for _, path := range p.altPaths {
+			if err == nil {
+				break
 			}
+			err = conn.Object(p.dest, path).CallWithContext(ctx, p.getActive, 0).Store(&active)
 		}
-	}()
+		if err != nil {
+			return Lock{}, err
+		}
+		return newSnapshot(p.kind(active), BackendDBus, p.getActive), nil
+	}
+	return Lock{}, fmt.Errorf("%s: state query is not supported", p.iface)
+}
+
+func init() {
+	Register(BackendDBus, func() (Backend, error) { return NewScreenSaverBackend(), nil })
+	Register(BackendLogind, func() (Backend, error) { return NewLogindBackend(), nil })
+	Register(BackendLogindSessions, func() (Backend, error) { return NewLogindSessionsBackend(), nil })
+	Register(BackendProcess, func() (Backend, error) { return NewProcessBackend(ProcessConfig{}), nil })
+	Register(BackendXScreenSaver, func() (Backend, error) { return NewXScreenSaverBackend(), nil })
+}
+
+// defaultBackends picks the desktop screensaver running on the session
+// bus, logind otherwise. See DetectDesktop.
+func defaultBackends(ctx context.Context, bus string) ([]Backend, error) {
+	d, _ := detectOnBus(ctx, bus)
+	logDetection(d)
+	if d.Backend == BackendDBus {
+		// Сервис уже определён, resolve не повторяет определение.
+		return []Backend{&ScreenSaverBackend{param: &d.param}}, nil
+	}
+	b, err := newBackend(d.Backend)
+	if err != nil {
+		return nil, err
+	}
+	return []Backend{b}, nil
+}
+
+// ScreenSaverBackend watches ActiveChanged of the desktop screensaver
+// on the session bus. The service is chosen as in DetectDesktop.
+type ScreenSaverBackend struct {
+	baseBackend
+	param *paramDBUS
+	bus   string
+}
+
+func NewScreenSaverBackend() *ScreenSaverBackend {
+	return &ScreenSaverBackend{}
+}
+
+func (b *ScreenSaverBackend) Name() string { return BackendDBus }
+
+func (b *ScreenSaverBackend) setBus(bus string) { b.bus = bus }
+
+func (b *ScreenSaverBackend) Capabilities() Capability {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	caps := CapScreenSaver
+	if b.param != nil && b.param.locks {
+		caps = CapLock
+	}
+	if b.param == nil || b.param.getActive != "" || b.param.property != "" {
+		caps |= CapState
+	}
+	return caps
+}
 
+// resolve detects the screensaver service on the first use. The best
+// ranked service is used even when it is not running.
+func (b *ScreenSaverBackend) resolve(ctx context.Context, conn *dbus.Conn) paramDBUS {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.param == nil {
+		d := detectDesktop(ctx, conn)
+		logDetection(d)
+		b.param = &d.param
+	}
+	return *b.param
+}
+
+func (b *ScreenSaverBackend) Start(ctx context.Context, events chan<- Lock) error {
+	w := &signalWatch{
+		dial: func() (*dbus.Conn, error) { return connectBus(b.bus) },
+	}
+	w.subscribe = func(ctx context.Context, conn *dbus.Conn) error {
+		param := b.resolve(ctx, conn)
+		w.name = param.dest
+		w.paths = param.paths()
+		w.event = param.decode
+		if param.getActive != "" || param.property != "" {
+			w.state = param.state
+		}
+		// Подписка на события
+		if err := conn.AddMatchSignal(param.matchOptions()...); err != nil {
+			return fmt.Errorf("subscribe on %s: %w", param.iface, err)
+		}
+		return nil
+	}
+	if err := w.open(ctx); err != nil {
+		return err
+	}
+	go w.run(b.watch(ctx), events, b.setErr)
 	return nil
 }
 
-func IsRemoteSession() (bool, error) {
-	display := os.Getenv("DISPLAY")
-	if display == "" {
-		return false, error.New("Сессия не является графической (возможно, это консоль или SSH без X11).")
-	} else if display == ":0" || display == ":1" {
-		return false, nil
-	} else {
-		return true, nil
+func (b *ScreenSaverBackend) State(ctx context.Context) (Lock, error) {
+	conn, err := connectBus(b.bus)
+	if err != nil {
+		return Lock{}, err
 	}
+	defer func() { _ = conn.Close() }()
+
+	return b.resolve(ctx, conn).state(ctx, conn)
 }
 
-func (l *NotifyLock) getDbusParams() (p paramDBUS) {
-	osDesc := os.Getenv("XDG_CURRENT_DESKTOP")
-	fmt.Println(osDesc)
-	switch osDesc {
-	case "ubuntu:GNOME": //work tested
-		p.iface = "org.gnome.ScreenSaver"
-		p.member = "ActiveChanged"
-	case "Unity":
-		p.iface = "com.canonical.Unity"
-		p.member = "ActiveChanged"
-	case "KDE":
-		p.iface = "org.kde.screensaver"
-		p.member = "ActiveChanged" //ok
-	case "XFCE":
-		p.iface = "xfce4-session"
-		p.member = "???"
-	case "LXQt":
-	case "Cinnamon":
-		p.iface = "org.Cinnamon.ScreenSaver"
-		p.member = "ActiveChanged" //ok
-	case "LXDE":
-	case "Deepin":
-		p.iface = "com.deepin.ScreenSaver"
-		p.member = "???"
-	default: // default to gnome
-		p.iface = "org.gnome.ScreenSaver"
-		p.member = "ActiveChanged"
-	}
-	return
+// screenSaverKind maps the ActiveChanged argument of the desktop
+// screensaver interfaces.
+func screenSaverKind(active bool) EventKind {
+	if active {
+		return EventScreenSaverStart
+	}
+	return EventScreenSaverStop
 }
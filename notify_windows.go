@@ -5,123 +5,151 @@ package notify_lock_session
 import (
 	"context"
 	"errors"
+	"fmt"
 	"log/slog"
+	"net/netip"
+	"runtime"
 	"strconv"
+	"sync"
 	"syscall"
 	"time"
 	"unsafe"
 )
 
-func (l *NotifyLock) relayMessage(message uint32, wParam uintptr) {
+func init() {
+	Register(BackendWTS, func() (Backend, error) { return NewWTSBackend(), nil })
+}
+
+func defaultBackends(ctx context.Context, bus string) ([]Backend, error) {
+	return []Backend{NewWTSBackend()}, nil
+}
+
+// WTSBackend receives WM_WTSSESSION_CHANGE for the current session in a
+// hidden message window.
+type WTSBackend struct {
+	baseBackend
+	// window is set by watchSessionNotifications before Start returns.
+	window   HWND
+	messages chan Message
+}
+
+func NewWTSBackend() *WTSBackend {
+	return &WTSBackend{messages: make(chan Message, 1000)}
+}
+
+// wtsWindows routes the messages of the shared window class to the backend
+// owning the window.
+var (
+	wtsWindowsMu sync.Mutex
+	wtsWindows   = map[HWND]*WTSBackend{}
+)
 
+func (b *WTSBackend) Name() string { return BackendWTS }
+
+func (b *WTSBackend) Capabilities() Capability { return CapLock | CapSession | CapState }
+
+// relayMessage queues the message for Start without waiting, so a slow
+// consumer never stalls the window procedure.
+func (b *WTSBackend) relayMessage(message uint32, wParam uintptr) {
 	msg := Message{
 		UMsg:  int(message),
 		Param: int(wParam),
 	}
-	msg.ChanOk = make(chan int)
-
-	chanMessages <- msg
-
-	<-msg.ChanOk
+	select {
+	case b.messages <- msg:
+	default:
+		slog.Warn("Session message queue is full, message dropped", slog.Int("msg", msg.UMsg), slog.Int("param", msg.Param))
+	}
 }
 
-func (l *NotifyLock) Subscribe(ctx context.Context, lock chan Lock) error {
-	var threadHandle HANDLE
+func (b *WTSBackend) Start(ctx context.Context, events chan<- Lock) error {
+	ready := make(chan error, 1)
+	go b.watchSessionNotifications(ready)
+	if err := <-ready; err != nil {
+		return err
+	}
+	window := b.window
+	ctx = b.watch(ctx)
 
-	go func() {
-		<-time.After(time.Second * 1)
-		status, _ := CheckSessionStatus()
-		lock <- Lock{
-			Lock:  status,
-			Clock: time.Now(),
-		}
-	}()
 	go func() {
 		for {
 			select {
 			case <-ctx.Done():
 				slog.Info("End watch lock")
-				l.stop(threadHandle)
-				var result bool
-				r0, _, msg := procCloseHandle.Call(uintptr(threadHandle), uintptr(unsafe.Pointer(&result)))
-				if r0 != 0 {
-					slog.Error("CloseHandle", slog.Any("error", msg))
-				}
+				b.stop(window)
 				return
-			case m := <-chanMessages:
+			case m := <-b.messages:
 				switch m.UMsg {
 				case WM_WTSSESSION_CHANGE:
-					switch m.Param {
-					case WTS_CONSOLE_DISCONNECT,
-						WTS_REMOTE_DISCONNECT,
-						WTS_SESSION_LOCK,
-						WTS_SESSION_LOGOFF:
-						l := Lock{
-							Lock:  true,
-							Clock: time.Now(),
-						}
-						lock <- l
-						break
-					case WTS_CONSOLE_CONNECT,
-						WTS_REMOTE_CONNECT,
-						WTS_SESSION_UNLOCK,
-						WTS_SESSION_LOGON:
-						l := Lock{
-							Lock:  false,
-							Clock: time.Now(),
-						}
-						lock <- l
-						break
+					if kind, source, ok := wtsEventKind(m.Param); ok {
+						send(ctx, events, newLock(kind, BackendWTS, source))
 					}
-
 				case WM_QUERYENDSESSION:
 					slog.Info("log off or shutdown")
 				}
-				close(m.ChanOk)
 			}
 		}
 	}()
 
-	go func() {
-		var err error
-		threadHandle, err = l.start()
-		if err != nil {
-			slog.Error("CreateThread", slog.Any("error", err))
-		}
-	}()
-
 	return nil
 }
 
-func (l *NotifyLock) start() (HANDLE, error) {
-	f := l.watchSessionNotifications()
-	h, _, err := l.createThread(uintptr(unsafe.Pointer(&f)))
-
-	return h, err
+// wtsEventKind maps the wParam of WM_WTSSESSION_CHANGE.
+func wtsEventKind(param int) (kind EventKind, source string, ok bool) {
+	switch param {
+	case WTS_CONSOLE_CONNECT:
+		return EventConsoleConnect, "WTS_CONSOLE_CONNECT", true
+	case WTS_CONSOLE_DISCONNECT:
+		return EventConsoleDisconnect, "WTS_CONSOLE_DISCONNECT", true
+	case WTS_REMOTE_CONNECT:
+		return EventRemoteConnect, "WTS_REMOTE_CONNECT", true
+	case WTS_REMOTE_DISCONNECT:
+		return EventRemoteDisconnect, "WTS_REMOTE_DISCONNECT", true
+	case WTS_SESSION_LOGON:
+		return EventLogon, "WTS_SESSION_LOGON", true
+	case WTS_SESSION_LOGOFF:
+		return EventLogoff, "WTS_SESSION_LOGOFF", true
+	case WTS_SESSION_LOCK:
+		return EventLocked, "WTS_SESSION_LOCK", true
+	case WTS_SESSION_UNLOCK:
+		return EventUnlocked, "WTS_SESSION_UNLOCK", true
+	case WTS_SESSION_CREATE:
+		return EventSessionCreate, "WTS_SESSION_CREATE", true
+	case WTS_SESSION_TERMINATE:
+		return EventSessionTerminate, "WTS_SESSION_TERMINATE", true
+	}
+	return EventUnknown, "", false
 }
 
-func (l *NotifyLock) stop(hwnd HANDLE) {
-	r0, _, err0 := syscall.SyscallN(procTerminateThread.Addr(), 0, 0, uintptr(hwnd), 0, 0, 0)
-	err := int32(r0)
-	if err != 0 {
-		slog.Error("TerminateThread ", slog.Any("error", err0.Error()))
+// stop ends the message loop of the notification window.
+func (b *WTSBackend) stop(window HWND) {
+	if err := PostMessage(window, WM_QUIT, 0, 0); err != nil {
+		slog.Error("PostMessage WM_QUIT", slog.Any("error", err))
 	}
 }
 
-func (l *NotifyLock) watchSessionNotifications() uintptr {
+// watchSessionNotifications creates the notification window and runs its
+// message loop. The result of the setup is sent to ready before the loop
+// starts.
+func (b *WTSBackend) watchSessionNotifications(ready chan<- error) {
 	const lpClassName = "classWatchSessionNotifications"
 
+	// Окно и его очередь сообщений привязаны к потоку.
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
 	wc := WNDCLASS{
-		PfnWndProc:   l.wndProc,
+		PfnWndProc:   wtsWndProc,
 		PszClassName: lpClassName,
 		Menu:         lpClassName,
 	}
 	_, err := RegisterClass(&wc)
-	if err != nil {
-		slog.Error("Error RegisterClass:", slog.Any("error", err))
+	if err != nil && !errors.Is(err, syscall.Errno(ERROR_CLASS_ALREADY_EXISTS)) {
+		ready <- fmt.Errorf("RegisterClass: %w", err)
+		return
 	}
 
-	hwnd, err = CreateWindowExW(lpClassName,
+	window, err := CreateWindowExW(lpClassName,
 		lpClassName,
 		WS_OVERLAPPEDWINDOW,
 		0,
@@ -129,19 +157,36 @@ func (l *NotifyLock) watchSessionNotifications() uintptr {
 		CW_USEDEFAULT,
 		100, 100,
 		0, 0, 0, 0)
+	if err == nil && window == 0 {
+		err = syscall.GetLastError()
+	}
 	if err != nil {
-		slog.Error("Error CreateWindow:", slog.Any("error", err))
+		ready <- fmt.Errorf("CreateWindow: %w", err)
+		return
 	}
-	slog.Debug("CreateWindow:", slog.String("handle", strconv.Itoa(int(hwnd))))
-	err = UpdateWindow(hwnd)
+	defer DestroyWindow(window)
+	b.window = window
+	wtsWindowsMu.Lock()
+	wtsWindows[window] = b
+	wtsWindowsMu.Unlock()
+	defer func() {
+		wtsWindowsMu.Lock()
+		delete(wtsWindows, window)
+		wtsWindowsMu.Unlock()
+	}()
+	slog.Debug("CreateWindow:", slog.String("handle", strconv.Itoa(int(window))))
+	err = UpdateWindow(window)
 	if err != nil {
 		slog.Error("UpdateWindow:", slog.Any("error", err))
 	}
 
-	r0, _, err0 := procWTSRegisterSessionNotification.Call(uintptr(hwnd), NOTIFY_FOR_THIS_SESSION)
+	r0, _, err0 := procWTSRegisterSessionNotification.Call(uintptr(window), NOTIFY_FOR_THIS_SESSION)
 	if r0 == 0 {
-		slog.Debug("Message WTSRegisterSessionNotification:", slog.Any("msg", err0.Error()))
+		ready <- fmt.Errorf("WTSRegisterSessionNotification: %w", err0)
+		return
 	}
+	defer func() { _, _, _ = procWTSUnRegisterSessionNotification.Call(uintptr(window)) }()
+	ready <- nil
 
 	msg := MSG{}
 	res := GetMessage(&msg, 0, 0, 0)
@@ -150,17 +195,31 @@ func (l *NotifyLock) watchSessionNotifications() uintptr {
 		DispatchMessage(&msg)
 		res = GetMessage(&msg, 0, 0, 0)
 	}
+	if res < 0 {
+		b.setErr(fmt.Errorf("GetMessage: %w", syscall.GetLastError()))
+	}
+}
 
-	return 0
+// wtsWndProc is the window procedure of the class shared by all WTSBackend
+// windows. Messages arriving before the window is routed, such as
+// WM_CREATE, go to DefWindowProc.
+func wtsWndProc(hWnd HWND, message uint32, wParam uintptr, lParam uintptr) uintptr {
+	wtsWindowsMu.Lock()
+	b := wtsWindows[hWnd]
+	wtsWindowsMu.Unlock()
+	if b == nil {
+		return DefWindowProc(hWnd, message, wParam, lParam)
+	}
+	return b.wndProc(hWnd, message, wParam, lParam)
 }
 
-func (l *NotifyLock) wndProc(hWnd HWND, message uint32, wParam uintptr, lParam uintptr) uintptr {
+func (b *WTSBackend) wndProc(hWnd HWND, message uint32, wParam uintptr, lParam uintptr) uintptr {
 	switch message {
 	case WM_QUERYENDSESSION:
-		l.relayMessage(message, lParam)
+		b.relayMessage(message, lParam)
 		break
 	case WM_WTSSESSION_CHANGE:
-		l.relayMessage(message, wParam)
+		b.relayMessage(message, wParam)
 		break
 	default:
 		return DefWindowProc(hWnd, message, wParam, lParam)
@@ -168,21 +227,22 @@ func (l *NotifyLock) wndProc(hWnd HWND, message uint32, wParam uintptr, lParam u
 	return 0
 }
 
-func (l *NotifyLock) createThread(proc uintptr) (h HANDLE, tid uintptr, err error) {
-	lpParameter := 1
-	//	r0, e1, err := syscall.SyscallN(procCreateThread.Addr(), 0, 0, proc, uintptr(unsafe.Pointer(&lpParameter)), 0, uintptr(unsafe.Pointer(&tid)))
-	r0, e1, err := procCreateThread.Call(0, 0, proc, uintptr(unsafe.Pointer(&lpParameter)), 0, uintptr(unsafe.Pointer(&tid)))
-	if e1 != 0 {
-		//err = error(e1)
-	} else {
-		h = HANDLE(r0)
+// State returns the current lock state of the caller's session, the one
+// the notification window is registered for.
+func (b *WTSBackend) State(ctx context.Context) (Lock, error) {
+	status, err := CheckSessionStatus()
+	if err != nil {
+		return Lock{}, err
 	}
-	return h, e1, err
+	return newSnapshot(lockedKind(status), BackendWTS, "WTSSessionInfoEx"), nil
 }
 
 func CheckSessionStatus() (isLock bool, err error) {
 
-	sessionId := getSessionId()
+	sessionId, err := currentSessionId()
+	if err != nil {
+		return false, err
+	}
 	slog.Debug("Id:", slog.String("session", strconv.Itoa(int(sessionId))))
 	/*	rs, _ := isRemoteSession(sessionId)
 		log.Println("Remote session:", rs)*/
@@ -221,36 +281,169 @@ func getLockSession(sessionId uint32) (isLock bool, err error) {
 	}
 }
 
+// IsRemoteSession reports whether the caller runs in an RDP session, see
+// DetectRemoteSession.
 func IsRemoteSession() (bool, error) {
-	var buffer *uint32
-	var bytesReturned uint32
+	r, err := DetectRemoteSession()
+	return r.Remote, err
+}
+
+// DetectRemoteSession reports whether the session of the caller is an RDP
+// session, see WTSIsRemoteSession.
+func DetectRemoteSession() (RemoteSession, error) {
+	sessionId, err := currentSessionId()
+	if err != nil {
+		return RemoteSession{}, err
+	}
+	info, err := wtsSessionInfo(sessionId)
+	if err != nil {
+		return RemoteSession{}, err
+	}
+	r := RemoteSession{
+		Remote:   info.Remote,
+		Evidence: []string{"WTSIsRemoteSession=" + strconv.FormatBool(info.Remote)},
+	}
+	if info.Remote {
+		r.Protocol = "rdp"
+		r.Client = info.RemoteHost
+		if r.Client == "" {
+			r.Client = info.ClientName
+		}
+	}
+	return r, nil
+}
 
-	sessionId := getSessionId()
+// CurrentSession describes the session the caller runs in.
+func CurrentSession() (SessionInfo, error) {
+	sessionId, err := currentSessionId()
+	if err != nil {
+		return SessionInfo{}, err
+	}
+	return wtsSessionInfo(sessionId)
+}
 
-	// Получаем состояние сессии
-	r1, _, _ := procWTSQuerySessionInformation.Call(
+func wtsSessionInfo(sessionId uint32) (SessionInfo, error) {
+	info := SessionInfo{ID: strconv.FormatUint(uint64(sessionId), 10)}
+	err := wtsQuery(sessionId, WTSSessionInfo, func(buffer unsafe.Pointer) {
+		wi := (*WTSINFOW)(buffer)
+		info.User = syscall.UTF16ToString(wi.UserName[:])
+		info.Seat = syscall.UTF16ToString(wi.WinStationName[:])
+		info.Active = wi.State == WTSActive
+		if wi.LogonTime > 0 {
+			ft := syscall.Filetime{LowDateTime: uint32(wi.LogonTime), HighDateTime: uint32(wi.LogonTime >> 32)}
+			info.LogonTime = time.Unix(0, ft.Nanoseconds())
+		}
+	})
+	if err != nil {
+		return SessionInfo{}, err
+	}
+	if info.User != "" {
+		info.Locked, _ = getLockSession(sessionId)
+	}
+	_ = wtsQuery(sessionId, WTSIsRemoteSession, func(buffer unsafe.Pointer) {
+		info.Remote = *(*bool)(buffer)
+	})
+	if !info.Remote {
+		return info, nil
+	}
+	_ = wtsQuery(sessionId, WTSClientName, func(buffer unsafe.Pointer) {
+		info.ClientName = utf16PtrToString((*uint16)(buffer))
+	})
+	_ = wtsQuery(sessionId, WTSClientAddress, func(buffer unsafe.Pointer) {
+		info.RemoteHost = clientAddress((*WTS_CLIENT_ADDRESS)(buffer))
+	})
+	return info, nil
+}
+
+// ListSessions describes the sessions of the local machine. The listener
+// sessions of the remote desktop services are skipped.
+func ListSessions() ([]SessionInfo, error) {
+	var list unsafe.Pointer
+	var count uint32
+
+	r1, _, err := procWTSEnumerateSessions.Call(
+		0, // hServer (0 для локальной машины)
+		0,
+		1,
+		uintptr(unsafe.Pointer(&list)),
+		uintptr(unsafe.Pointer(&count)),
+	)
+	if r1 == 0 {
+		return nil, fmt.Errorf("WTSEnumerateSessions: %w", err)
+	}
+	defer func() { _, _, _ = procWTSFreeMemory.Call(uintptr(list)) }()
+
+	var sessions []SessionInfo
+	for _, s := range unsafe.Slice((*WTS_SESSION_INFO)(list), count) {
+		if s.State == WTSListen {
+			continue
+		}
+		info, err := wtsSessionInfo(s.SessionId)
+		if err != nil {
+			// Сессия могла завершиться после WTSEnumerateSessions.
+			continue
+		}
+		sessions = append(sessions, info)
+	}
+	return sessions, nil
+}
+
+// wtsQuery calls WTSQuerySessionInformation and passes the buffer to read
+// before it is freed.
+func wtsQuery(sessionId uint32, infoClass uintptr, read func(buffer unsafe.Pointer)) error {
+	var buffer unsafe.Pointer
+	var bytesReturned uint32
+
+	r1, _, err := procWTSQuerySessionInformation.Call(
 		0, // hServer (0 для локальной машины)
 		uintptr(sessionId),
-		WTSIsRemoteSession,
+		infoClass,
 		uintptr(unsafe.Pointer(&buffer)),
 		uintptr(unsafe.Pointer(&bytesReturned)),
 	)
-
 	if r1 == 0 {
-		return false, errors.New("Ошибка получения состояния сессии. WTSIsRemoteSession")
+		return fmt.Errorf("WTSQuerySessionInformation(%d): %w", infoClass, err)
 	}
-	b := (*bool)(unsafe.Pointer(buffer))
-	//_, _, _ = procWTSFreeMemory.Call(uintptr(unsafe.Pointer(&buffer)))
-	return *b, nil
+	defer func() { _, _, _ = procWTSFreeMemory.Call(uintptr(buffer)) }()
+	if buffer != nil {
+		read(buffer)
+	}
+	return nil
+}
+
+func clientAddress(a *WTS_CLIENT_ADDRESS) string {
+	switch a.AddressFamily {
+	case AF_INET:
+		return netip.AddrFrom4([4]byte(a.Address[2:6])).String()
+	case AF_INET6:
+		return netip.AddrFrom16([16]byte(a.Address[2:18])).String()
+	}
+	return ""
 }
 
-func getSessionId() uint32 {
-	ret, _, _ := procWTSGetActiveConsoleSessionId.Call()
-	return uint32(ret)
+func utf16PtrToString(p *uint16) string {
+	if p == nil {
+		return ""
+	}
+	n := 0
+	for ptr := unsafe.Pointer(p); *(*uint16)(ptr) != 0; n++ {
+		ptr = unsafe.Add(ptr, 2)
+	}
+	return syscall.UTF16ToString(unsafe.Slice(p, n))
+}
+
+// currentSessionId returns the session of the calling process, which differs
+// from the active console session under RDP and fast user switching.
+func currentSessionId() (uint32, error) {
+	var sessionId uint32
+	r1, _, err := procProcessIdToSessionId.Call(uintptr(syscall.Getpid()), uintptr(unsafe.Pointer(&sessionId)))
+	if r1 == 0 {
+		return 0, fmt.Errorf("ProcessIdToSessionId: %w", err)
+	}
+	return sessionId, nil
 }
 
 type Message struct {
-	UMsg   int
-	Param  int
-	ChanOk chan int
+	UMsg  int
+	Param int
 }
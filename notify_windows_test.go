@@ -13,7 +13,8 @@ func TestSubscribe(t *testing.T) {
 	msg := make(chan Lock, 1)
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
-	nl := NotifyLock{}
+	b := NewWTSBackend()
+	nl := New(UseBackend(b))
 	err := nl.Subscribe(ctx, msg)
 	if err != nil {
 		t.Error(err)
@@ -39,8 +40,8 @@ func TestSubscribe(t *testing.T) {
 
 	<-time.After(time.Second * 1)
 
-	res := SendMessage(hwnd, WM_WTSSESSION_CHANGE, WTS_SESSION_LOCK, 0)
-	fmt.Println("Result:", res, hwnd)
+	res := SendMessage(b.window, WM_WTSSESSION_CHANGE, WTS_SESSION_LOCK, 0)
+	fmt.Println("Result:", res, b.window)
 	//_ = SendMessage(hwnd, WM_WTSSESSION_CHANGE, WTS_SESSION_UNLOCK, 0)
 	//_ = SendMessage(hwnd, WM_WTSSESSION_CHANGE, WTS_SESSION_LOCK, 0)
 	//	_ = SendMessage(hwnd, WM_WTSSESSION_CHANGE, WTS_SESSION_UNLOCK, 0)
@@ -48,6 +49,35 @@ func TestSubscribe(t *testing.T) {
 	<-ctx.Done()
 }
 
+func TestWTSBackendsSeparate(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	a, b := NewWTSBackend(), NewWTSBackend()
+	lockA, lockB := make(chan Lock, 1), make(chan Lock, 1)
+	if err := a.Start(ctx, lockA); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Start(ctx, lockB); err != nil {
+		t.Fatal(err)
+	}
+
+	// Каждое окно доставляет сообщения только своему экземпляру.
+	SendMessage(b.window, WM_WTSSESSION_CHANGE, WTS_SESSION_LOCK, 0)
+	select {
+	case l := <-lockB:
+		if l.Kind != EventLocked {
+			t.Errorf("b: %+v", l)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("b: no event received")
+	}
+	select {
+	case l := <-lockA:
+		t.Errorf("a received %+v", l)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
 func TestRemote(t *testing.T) {
 	_, err := IsRemoteSession()
 	if err != nil {
@@ -64,3 +94,36 @@ func SendMessage(hwnd HWND, msg uint32, wParam, lParam uintptr) uintptr {
 
 	return ret
 }
+
+func TestClientAddress(t *testing.T) {
+	v4 := WTS_CLIENT_ADDRESS{AddressFamily: AF_INET}
+	copy(v4.Address[2:], []byte{192, 168, 1, 20})
+	if got := clientAddress(&v4); got != "192.168.1.20" {
+		t.Errorf("clientAddress(IPv4) = %q", got)
+	}
+	if got := clientAddress(&WTS_CLIENT_ADDRESS{}); got != "" {
+		t.Errorf("clientAddress(AF_UNSPEC) = %q", got)
+	}
+}
+
+func TestCurrentSession(t *testing.T) {
+	info, err := CurrentSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.ID == "" || info.Seat == "" {
+		t.Errorf("CurrentSession() = %+v", info)
+	}
+}
+
+func TestListSessions(t *testing.T) {
+	sessions, err := ListSessions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range sessions {
+		if s.ID == "" {
+			t.Errorf("session without ID: %+v", s)
+		}
+	}
+}
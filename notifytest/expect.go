@@ -0,0 +1,52 @@
+package notifytest
+
+import (
+	"testing"
+	"time"
+
+	notifyLS "github.com/Fast-IQ/notify-lock-session"
+)
+
+// NextEvent returns the next event received on ch within d.
+func NextEvent(t testing.TB, ch <-chan notifyLS.Lock, d time.Duration) notifyLS.Lock {
+	t.Helper()
+	select {
+	case l := <-ch:
+		return l
+	case <-time.After(d):
+		t.Fatalf("no event within %s", d)
+	}
+	return notifyLS.Lock{}
+}
+
+// ExpectEvent fails the test unless the next event on ch arrives within d
+// and has the given kind.
+func ExpectEvent(t testing.TB, ch <-chan notifyLS.Lock, kind notifyLS.EventKind, d time.Duration) notifyLS.Lock {
+	t.Helper()
+	l := NextEvent(t, ch, d)
+	if l.Kind != kind {
+		t.Fatalf("got %s event, want %s", l.Kind, kind)
+	}
+	return l
+}
+
+// ExpectSnapshot fails the test unless the next event on ch arrives within
+// d and is a snapshot with the given lock state.
+func ExpectSnapshot(t testing.TB, ch <-chan notifyLS.Lock, locked bool, d time.Duration) notifyLS.Lock {
+	t.Helper()
+	l := NextEvent(t, ch, d)
+	if !l.Snapshot || l.Lock != locked {
+		t.Fatalf("got %s event (snapshot %t), want snapshot with lock %t", l.Kind, l.Snapshot, locked)
+	}
+	return l
+}
+
+// ExpectNoEvent fails the test if an event arrives on ch within d.
+func ExpectNoEvent(t testing.TB, ch <-chan notifyLS.Lock, d time.Duration) {
+	t.Helper()
+	select {
+	case l := <-ch:
+		t.Fatalf("unexpected %s event from %s", l.Kind, l.Backend)
+	case <-time.After(d):
+	}
+}
@@ -0,0 +1,255 @@
+// Package notifytest provides a scriptable session backend and assertion
+// helpers for testing code built on notify_lock_session without a real
+// desktop.
+package notifytest
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	notifyLS "github.com/Fast-IQ/notify-lock-session"
+)
+
+// BackendName is the default name of the fake backend.
+const BackendName = "notifytest"
+
+// ErrNotStarted is returned by Emit before Start or after Stop.
+var ErrNotStarted = errors.New("notifytest: backend is not started")
+
+// Clock stamps the scripted events.
+type Clock interface {
+	Now() time.Time
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time { return time.Now() }
+
+// FakeClock is a Clock that only moves when told to.
+type FakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func NewFakeClock(now time.Time) *FakeClock {
+	return &FakeClock{now: now}
+}
+
+func (c *FakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// Advance moves the clock forward by d.
+func (c *FakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	c.now = c.now.Add(d)
+	c.mu.Unlock()
+}
+
+// Set moves the clock to now.
+func (c *FakeClock) Set(now time.Time) {
+	c.mu.Lock()
+	c.now = now
+	c.mu.Unlock()
+}
+
+// Option configures a Backend created by NewBackend.
+type Option func(*Backend)
+
+// WithName changes the name reported in Lock.Backend.
+func WithName(name string) Option {
+	return func(b *Backend) {
+		b.name = name
+	}
+}
+
+// WithClock stamps events with clock instead of the wall clock.
+func WithClock(clock Clock) Option {
+	return func(b *Backend) {
+		b.clock = clock
+	}
+}
+
+// WithInitialState sets the state returned by State before any event.
+func WithInitialState(kind notifyLS.EventKind) Option {
+	return func(b *Backend) {
+		b.kind = kind
+	}
+}
+
+// WithCapabilities overrides the reported capabilities.
+func WithCapabilities(caps notifyLS.Capability) Option {
+	return func(b *Backend) {
+		b.caps = caps
+	}
+}
+
+// WithStartError makes Start fail with err.
+func WithStartError(err error) Option {
+	return func(b *Backend) {
+		b.startErr = err
+	}
+}
+
+// WithStateError makes State fail with err.
+func WithStateError(err error) Option {
+	return func(b *Backend) {
+		b.stateErr = err
+	}
+}
+
+// Backend is a notifyLS.Backend driven by the test.
+type Backend struct {
+	name     string
+	clock    Clock
+	caps     notifyLS.Capability
+	startErr error
+	stateErr error
+
+	mu      sync.Mutex
+	kind    notifyLS.EventKind
+	ctx     context.Context
+	cancel  context.CancelFunc
+	events  chan<- notifyLS.Lock
+	err     error
+	started chan struct{}
+}
+
+var _ notifyLS.Backend = (*Backend)(nil)
+
+// NewBackend returns an unlocked fake backend.
+func NewBackend(opts ...Option) *Backend {
+	b := &Backend{
+		name:    BackendName,
+		clock:   realClock{},
+		caps:    notifyLS.CapLock | notifyLS.CapScreenSaver | notifyLS.CapSession | notifyLS.CapState,
+		kind:    notifyLS.EventUnlocked,
+		started: make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(b)
+	}
+	return b
+}
+
+func (b *Backend) Name() string { return b.name }
+
+func (b *Backend) Capabilities() notifyLS.Capability { return b.caps }
+
+func (b *Backend) Start(ctx context.Context, events chan<- notifyLS.Lock) error {
+	if b.startErr != nil {
+		return b.startErr
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.ctx, b.cancel = context.WithCancel(ctx)
+	b.events = events
+	b.err = nil
+	select {
+	case <-b.started:
+	default:
+		close(b.started)
+	}
+	return nil
+}
+
+func (b *Backend) Stop() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.cancel != nil {
+		b.cancel()
+	}
+	b.events = nil
+	return nil
+}
+
+func (b *Backend) State(ctx context.Context) (notifyLS.Lock, error) {
+	if b.stateErr != nil {
+		return notifyLS.Lock{}, b.stateErr
+	}
+	b.mu.Lock()
+	l := b.lock(b.kind, "state")
+	b.mu.Unlock()
+	l.Snapshot = true
+	return l, nil
+}
+
+func (b *Backend) Err() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.err
+}
+
+// Started is closed after the first successful Start.
+func (b *Backend) Started() <-chan struct{} {
+	return b.started
+}
+
+// Fail reports err from Err as if the backend had stopped.
+func (b *Backend) Fail(err error) {
+	b.mu.Lock()
+	b.err = err
+	b.mu.Unlock()
+}
+
+func (b *Backend) lock(kind notifyLS.EventKind, source string) notifyLS.Lock {
+	return notifyLS.Lock{
+		Lock:    kind.Locked(),
+		Clock:   b.clock.Now(),
+		Kind:    kind,
+		Source:  source,
+		Backend: b.name,
+	}
+}
+
+// Emit sends an event of kind stamped by the clock and makes it the
+// current state. It blocks until the event is accepted.
+func (b *Backend) Emit(kind notifyLS.EventKind) error {
+	b.mu.Lock()
+	ctx, events := b.ctx, b.events
+	l := b.lock(kind, "notifytest."+kind.String())
+	b.kind = kind
+	b.mu.Unlock()
+
+	if events == nil {
+		return ErrNotStarted
+	}
+	select {
+	case events <- l:
+		return nil
+	case <-ctx.Done():
+		return ErrNotStarted
+	}
+}
+
+func (b *Backend) Lock() error   { return b.Emit(notifyLS.EventLocked) }
+func (b *Backend) Unlock() error { return b.Emit(notifyLS.EventUnlocked) }
+func (b *Backend) Logon() error  { return b.Emit(notifyLS.EventLogon) }
+func (b *Backend) Logoff() error { return b.Emit(notifyLS.EventLogoff) }
+
+// Step is one scripted event. After is the time between the previous step
+// and this one.
+type Step struct {
+	After time.Duration
+	Kind  notifyLS.EventKind
+}
+
+// Play emits the steps in order. With a FakeClock the clock is advanced by
+// Step.After, otherwise Play sleeps for it.
+func (b *Backend) Play(steps ...Step) error {
+	for _, step := range steps {
+		if c, ok := b.clock.(*FakeClock); ok {
+			c.Advance(step.After)
+		} else if step.After > 0 {
+			time.Sleep(step.After)
+		}
+		if err := b.Emit(step.Kind); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,67 @@
+package notifytest
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	notifyLS "github.com/Fast-IQ/notify-lock-session"
+)
+
+func TestScriptedSession(t *testing.T) {
+	start := time.Date(2024, 1, 2, 9, 0, 0, 0, time.UTC)
+	clock := NewFakeClock(start)
+	fake := NewBackend(WithClock(clock))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	lock := make(chan notifyLS.Lock, 10)
+	nl := notifyLS.New(notifyLS.UseBackend(fake))
+	if err := nl.Subscribe(ctx, lock); err != nil {
+		t.Fatal(err)
+	}
+
+	l := ExpectSnapshot(t, lock, false, time.Second)
+	if !l.Clock.Equal(start) || l.Backend != BackendName {
+		t.Errorf("snapshot = %+v", l)
+	}
+
+	err := fake.Play(
+		Step{After: time.Minute, Kind: notifyLS.EventLocked},
+		Step{After: time.Hour, Kind: notifyLS.EventUnlocked},
+		Step{After: time.Second, Kind: notifyLS.EventLogoff},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if l = ExpectEvent(t, lock, notifyLS.EventLocked, time.Second); !l.Lock || !l.Clock.Equal(start.Add(time.Minute)) {
+		t.Errorf("lock = %+v", l)
+	}
+	if l = ExpectEvent(t, lock, notifyLS.EventUnlocked, time.Second); !l.Clock.Equal(start.Add(time.Minute + time.Hour)) {
+		t.Errorf("unlock = %+v", l)
+	}
+	ExpectEvent(t, lock, notifyLS.EventLogoff, time.Second)
+	ExpectNoEvent(t, lock, 50*time.Millisecond)
+
+	if state, err := nl.State(ctx); err != nil || state.Kind != notifyLS.EventLogoff {
+		t.Errorf("State() = %+v, %v", state, err)
+	}
+
+	fake.Fail(errors.New("gone"))
+	if nl.Err() == nil {
+		t.Error("Err() did not report the failure")
+	}
+}
+
+func TestBackendErrors(t *testing.T) {
+	if err := NewBackend().Lock(); !errors.Is(err, ErrNotStarted) {
+		t.Errorf("Lock() before Start = %v", err)
+	}
+
+	errStart := errors.New("no session")
+	nl := notifyLS.New(notifyLS.UseBackend(NewBackend(WithStartError(errStart))))
+	if err := nl.Subscribe(context.Background(), nil); !errors.Is(err, errStart) {
+		t.Errorf("Subscribe() = %v", err)
+	}
+}
@@ -0,0 +1,174 @@
+//go:build linux
+
+package notify_lock_session
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// BackendProcess reports the session as locked while a screen locker
+// process of the user is running.
+const BackendProcess = "process"
+
+// DefaultLockers are the locker binaries watched by the process backend.
+// They lock the screen without any D-Bus signal.
+var DefaultLockers = []string{
+	"swaylock",
+	"hyprlock",
+	"i3lock",
+	"gtklock",
+	"waylock",
+	"xsecurelock",
+	"slock",
+	"physlock",
+	"xlock",
+	"xtrlock",
+}
+
+// ProcessConfig configures a ProcessBackend. Zero fields take the defaults.
+type ProcessConfig struct {
+	// Lockers are the binary names to look for, DefaultLockers when empty.
+	Lockers []string
+	// Interval between scans, one second by default.
+	Interval time.Duration
+	// ProcRoot is the proc filesystem, "/proc" by default.
+	ProcRoot string
+}
+
+// ProcessBackend scans the processes of the user for screen lockers. It is
+// meant for wlroots compositors and minimal window managers.
+type ProcessBackend struct {
+	baseBackend
+	cfg ProcessConfig
+	uid int
+}
+
+func NewProcessBackend(cfg ProcessConfig) *ProcessBackend {
+	if len(cfg.Lockers) == 0 {
+		cfg.Lockers = DefaultLockers
+	}
+	if cfg.Interval <= 0 {
+		cfg.Interval = time.Second
+	}
+	if cfg.ProcRoot == "" {
+		cfg.ProcRoot = "/proc"
+	}
+	return &ProcessBackend{cfg: cfg, uid: os.Getuid()}
+}
+
+func (b *ProcessBackend) Name() string { return BackendProcess }
+
+func (b *ProcessBackend) Capabilities() Capability { return CapLock | CapState }
+
+// setBus watches the processes of the user of UserBus.
+func (b *ProcessBackend) setBus(bus string) {
+	if uid, ok := busUser(bus); ok && uid >= 0 {
+		b.uid = uid
+	}
+}
+
+func (b *ProcessBackend) State(ctx context.Context) (Lock, error) {
+	locker, err := b.scan()
+	if err != nil {
+		return Lock{}, err
+	}
+	source := locker
+	if source == "" {
+		source = b.cfg.ProcRoot
+	}
+	return newSnapshot(lockedKind(locker != ""), BackendProcess, source), nil
+}
+
+func (b *ProcessBackend) Start(ctx context.Context, events chan<- Lock) error {
+	locker, err := b.scan()
+	if err != nil {
+		return err
+	}
+	ctx = b.watch(ctx)
+
+	go func() {
+		ticker := time.NewTicker(b.cfg.Interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			found, err := b.scan()
+			if err != nil {
+				b.setErr(err)
+				return
+			}
+			if (found != "") == (locker != "") {
+				continue
+			}
+			// При разблокировке источник - завершившийся блокировщик.
+			source := found
+			if source == "" {
+				source = locker
+			}
+			l := newLock(lockedKind(found != ""), BackendProcess, source)
+			locker = found
+			if !send(ctx, events, l) {
+				return
+			}
+		}
+	}()
+	return nil
+}
+
+// scan returns the first running locker of the user, "" when none runs.
+func (b *ProcessBackend) scan() (string, error) {
+	entries, err := os.ReadDir(b.cfg.ProcRoot)
+	if err != nil {
+		return "", err
+	}
+	for _, e := range entries {
+		if _, err := strconv.Atoi(e.Name()); err != nil || !e.IsDir() {
+			continue
+		}
+		dir := filepath.Join(b.cfg.ProcRoot, e.Name())
+		// Процесс мог завершиться во время обхода.
+		info, err := os.Stat(dir)
+		if err != nil {
+			continue
+		}
+		if st, ok := info.Sys().(*syscall.Stat_t); ok && int(st.Uid) != b.uid {
+			continue
+		}
+		if name := processName(dir); contains(b.cfg.Lockers, name) {
+			return name, nil
+		}
+		if name := processArg0(dir); contains(b.cfg.Lockers, name) {
+			return name, nil
+		}
+	}
+	return "", nil
+}
+
+// processName reads comm, which the kernel truncates to 15 bytes.
+func processName(dir string) string {
+	comm, err := os.ReadFile(filepath.Join(dir, "comm"))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(comm))
+}
+
+// processArg0 is the base name of the first command line argument.
+func processArg0(dir string) string {
+	cmdline, err := os.ReadFile(filepath.Join(dir, "cmdline"))
+	if err != nil || len(cmdline) == 0 {
+		return ""
+	}
+	arg0, _, _ := bytes.Cut(cmdline, []byte{0})
+	return filepath.Base(string(arg0))
+}
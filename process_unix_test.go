@@ -0,0 +1,95 @@
+//go:build linux
+
+package notify_lock_session
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// fakeProc is a fake /proc tree.
+type fakeProc string
+
+func (p fakeProc) start(t *testing.T, pid int, comm, cmdline string) {
+	t.Helper()
+	dir := filepath.Join(string(p), strconv.Itoa(pid))
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	err := os.WriteFile(filepath.Join(dir, "comm"), []byte(comm+"\n"), 0o644)
+	if err == nil {
+		err = os.WriteFile(filepath.Join(dir, "cmdline"), []byte(cmdline+"\x00"), 0o644)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func (p fakeProc) exit(t *testing.T, pid int) {
+	t.Helper()
+	if err := os.RemoveAll(filepath.Join(string(p), strconv.Itoa(pid))); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestProcessBackend(t *testing.T) {
+	proc := fakeProc(t.TempDir())
+	proc.start(t, 1, "systemd", "/sbin/init")
+	proc.start(t, 812, "sway", "sway")
+	if err := os.WriteFile(filepath.Join(string(proc), "uptime"), nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	b := NewProcessBackend(ProcessConfig{ProcRoot: string(proc), Interval: 10 * time.Millisecond})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	lock := make(chan Lock, 10)
+	if err := New(UseBackend(b)).Subscribe(ctx, lock); err != nil {
+		t.Fatal(err)
+	}
+	if l := nextLock(t, lock); !l.Snapshot || l.Lock {
+		t.Fatalf("snapshot = %+v", l)
+	}
+
+	proc.start(t, 901, "swaylock", "swaylock -f")
+	if l := nextLock(t, lock); l.Kind != EventLocked || l.Source != "swaylock" || l.Backend != BackendProcess {
+		t.Errorf("locked = %+v", l)
+	}
+	if l, _ := b.State(ctx); !l.Lock || l.Source != "swaylock" {
+		t.Errorf("State() = %+v", l)
+	}
+	proc.exit(t, 901)
+	if l := nextLock(t, lock); l.Kind != EventUnlocked || l.Source != "swaylock" {
+		t.Errorf("unlocked = %+v", l)
+	}
+}
+
+func TestProcessBackendLockers(t *testing.T) {
+	proc := fakeProc(t.TempDir())
+	// comm обрезается до 15 байт, имя берётся из cmdline.
+	proc.start(t, 7, "my-corporate-lo", "/opt/bin/my-corporate-locker\x00--now")
+
+	l, err := NewProcessBackend(ProcessConfig{ProcRoot: string(proc)}).State(context.Background())
+	if err != nil || l.Lock {
+		t.Errorf("default lockers: %+v, %v", l, err)
+	}
+	cfg := ProcessConfig{ProcRoot: string(proc), Lockers: []string{"my-corporate-locker"}}
+	l, err = NewProcessBackend(cfg).State(context.Background())
+	if err != nil || !l.Lock || l.Source != "my-corporate-locker" {
+		t.Errorf("custom lockers: %+v, %v", l, err)
+	}
+
+	other := NewProcessBackend(cfg)
+	other.setBus(UserBus(os.Getuid() + 1))
+	if l, _ := other.State(context.Background()); l.Lock {
+		t.Error("locker of another user reported")
+	}
+
+	if _, err := NewProcessBackend(ProcessConfig{ProcRoot: filepath.Join(string(proc), "missing")}).State(context.Background()); err == nil {
+		t.Error("missing proc root accepted")
+	}
+}
@@ -0,0 +1,139 @@
+//go:build linux
+
+package notify_lock_session
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// remoteEnv are the environment variables set by remote access servers.
+var remoteEnv = []struct{ name, protocol string }{
+	{"SSH_CONNECTION", "ssh"},
+	{"SSH_CLIENT", "ssh"},
+	{"XRDP_SESSION", "rdp"},
+	{"XRDP_SOCKET_PATH", "rdp"},
+	{"X2GO_SESSION", "x2go"},
+	{"NXSESSIONID", "nx"},
+	{"NX_SESSION_ID", "nx"},
+}
+
+// remoteParents are the servers found among the ancestors of a process in a
+// remote session.
+var remoteParents = map[string]string{
+	"sshd":           "ssh",
+	"xrdp":           "rdp",
+	"xrdp-sesman":    "rdp",
+	"x2goagent":      "x2go",
+	"x2goruncommand": "x2go",
+	"nxagent":        "nx",
+	"nxnode":         "nx",
+	"nxserver":       "nx",
+	"Xvnc":           "vnc",
+	"x0vncserver":    "vnc",
+	"x11vnc":         "vnc",
+}
+
+// logindServices map the PAM service of a logind session to the protocol.
+var logindServices = map[string]string{
+	"sshd":        "ssh",
+	"xrdp-sesman": "rdp",
+	"x2go":        "x2go",
+}
+
+// IsRemoteSession reports whether the caller runs in a remote session, see
+// DetectRemoteSession.
+func IsRemoteSession() (bool, error) {
+	r, err := DetectRemoteSession()
+	return r.Remote, err
+}
+
+// DetectRemoteSession combines the Remote and RemoteHost properties of the
+// logind session, the environment of SSH, xrdp, X2Go and NX and the parent
+// processes of the caller. Any of them marking the session remote is
+// enough.
+func DetectRemoteSession() (RemoteSession, error) {
+	return detectRemoteSession(context.Background(), "/proc", os.Getpid())
+}
+
+func detectRemoteSession(ctx context.Context, procRoot string, pid int) (RemoteSession, error) {
+	var r RemoteSession
+	found := func(protocol, client, evidence string) {
+		r.Remote = true
+		if r.Protocol == "" {
+			r.Protocol = protocol
+		}
+		if r.Client == "" {
+			r.Client = client
+		}
+		r.Evidence = append(r.Evidence, evidence)
+	}
+
+	if conn, err := connectBus("system"); err == nil {
+		path := logindSessionPath(ctx, conn)
+		info, err := logindSessionInfo(ctx, conn, path)
+		if err == nil {
+			var service string
+			_ = conn.Object(logindDest, path).StoreProperty(logindSessionIface+".Service", &service)
+			if info.Remote {
+				found(logindServices[service], info.RemoteHost, "logind Remote=true")
+			} else {
+				r.Evidence = append(r.Evidence, "logind Remote=false")
+			}
+		}
+		_ = conn.Close()
+	}
+
+	for _, env := range remoteEnv {
+		value := os.Getenv(env.name)
+		if value == "" {
+			continue
+		}
+		client := ""
+		if env.protocol == "ssh" {
+			// "адрес_клиента порт_клиента [адрес_сервера порт_сервера]"
+			client, _, _ = strings.Cut(value, " ")
+		}
+		found(env.protocol, client, env.name)
+	}
+
+	if name, ok := remoteParent(procRoot, pid); ok {
+		found(remoteParents[name], "", "parent "+name)
+	}
+	return r, nil
+}
+
+// remoteParent walks the ancestors of pid up to init and returns the first
+// remote access server.
+func remoteParent(procRoot string, pid int) (string, bool) {
+	for i := 0; pid > 1 && i < 64; i++ {
+		dir := filepath.Join(procRoot, strconv.Itoa(pid))
+		stat, err := os.ReadFile(filepath.Join(dir, "stat"))
+		if err != nil {
+			return "", false
+		}
+		// comm в скобках может содержать пробелы и скобки.
+		end := strings.LastIndexByte(string(stat), ')')
+		if end < 0 {
+			return "", false
+		}
+		fields := strings.Fields(string(stat[end+1:]))
+		if len(fields) < 2 {
+			return "", false
+		}
+		if pid, err = strconv.Atoi(fields[1]); err != nil {
+			return "", false
+		}
+		if pid <= 1 {
+			break
+		}
+		name := processName(filepath.Join(procRoot, strconv.Itoa(pid)))
+		if _, ok := remoteParents[name]; ok {
+			return name, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,93 @@
+//go:build linux
+
+package notify_lock_session
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"testing"
+)
+
+// parent records ppid as the parent of pid in the fake /proc.
+func (p fakeProc) parent(t *testing.T, pid, ppid int, comm string) {
+	t.Helper()
+	stat := strconv.Itoa(pid) + " (" + comm + ") S " + strconv.Itoa(ppid) + " 1 1 0 -1\n"
+	err := os.WriteFile(filepath.Join(string(p), strconv.Itoa(pid), "stat"), []byte(stat), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// clearRemoteEnv hides the remote markers of the environment running the
+// tests.
+func clearRemoteEnv(t *testing.T) {
+	for _, env := range remoteEnv {
+		t.Setenv(env.name, "")
+	}
+}
+
+func TestDetectRemoteSession(t *testing.T) {
+	address := startTestBus(t)
+	t.Setenv("DBUS_SYSTEM_BUS_ADDRESS", address)
+	t.Setenv("XDG_SESSION_ID", "c1")
+	clearRemoteEnv(t)
+	fake := newFakeLogind(t, address)
+
+	proc := fakeProc(t.TempDir())
+	proc.start(t, 1, "systemd", "/sbin/init")
+	proc.parent(t, 1, 0, "systemd")
+	proc.start(t, 900, "gnome-shell", "/usr/bin/gnome-shell")
+	proc.parent(t, 900, 1, "gnome-shell")
+	proc.start(t, 950, "bash", "bash")
+	proc.parent(t, 950, 900, "bash")
+	ctx := context.Background()
+
+	r, err := detectRemoteSession(ctx, string(proc), 950)
+	if err != nil || r.Remote || !slices.Equal(r.Evidence, []string{"logind Remote=false"}) {
+		t.Errorf("local session: %+v, %v", r, err)
+	}
+
+	fake.props.SetMust(logindSessionIface, "Remote", true)
+	fake.props.SetMust(logindSessionIface, "RemoteHost", "203.0.113.7")
+	fake.props.SetMust(logindSessionIface, "Service", "sshd")
+	t.Setenv("SSH_CONNECTION", "203.0.113.7 50122 192.0.2.1 22")
+	r, _ = detectRemoteSession(ctx, string(proc), 950)
+	want := RemoteSession{Remote: true, Protocol: "ssh", Client: "203.0.113.7"}
+	if r.Remote != want.Remote || r.Protocol != want.Protocol || r.Client != want.Client ||
+		!slices.Equal(r.Evidence, []string{"logind Remote=true", "SSH_CONNECTION"}) {
+		t.Errorf("ssh session: %+v", r)
+	}
+}
+
+func TestDetectRemoteSessionWithoutLogind(t *testing.T) {
+	t.Setenv("DBUS_SYSTEM_BUS_ADDRESS", "unix:path="+filepath.Join(t.TempDir(), "none"))
+	clearRemoteEnv(t)
+	ctx := context.Background()
+
+	proc := fakeProc(t.TempDir())
+	proc.start(t, 700, "xrdp-sesman", "/usr/sbin/xrdp-sesman")
+	proc.parent(t, 700, 1, "xrdp-sesman")
+	proc.start(t, 710, "Xorg", "Xorg :10")
+	proc.parent(t, 710, 700, "Xorg")
+	proc.start(t, 720, "xterm", "xterm")
+	proc.parent(t, 720, 710, "xterm")
+
+	r, _ := detectRemoteSession(ctx, string(proc), 720)
+	if !r.Remote || r.Protocol != "rdp" || !slices.Equal(r.Evidence, []string{"parent xrdp-sesman"}) {
+		t.Errorf("parent chain: %+v", r)
+	}
+
+	t.Setenv("X2GO_SESSION", "user-50-1760778000_stDMATE_dp24")
+	r, _ = detectRemoteSession(ctx, string(proc), 1)
+	if !r.Remote || r.Protocol != "x2go" || r.Client != "" {
+		t.Errorf("x2go environment: %+v", r)
+	}
+
+	t.Setenv("X2GO_SESSION", "")
+	if r, _ = detectRemoteSession(ctx, string(proc), 1); r.Remote || len(r.Evidence) != 0 {
+		t.Errorf("no evidence: %+v", r)
+	}
+}
@@ -0,0 +1,88 @@
+package notify_lock_session
+
+import "time"
+
+// SessionType is the kind of a login session as reported by logind.
+type SessionType string
+
+const (
+	SessionTypeUnspecified SessionType = "unspecified"
+	SessionTypeTTY         SessionType = "tty"
+	SessionTypeX11         SessionType = "x11"
+	SessionTypeWayland     SessionType = "wayland"
+)
+
+// DisplayServer is the graphical server of a session.
+type DisplayServer string
+
+const (
+	// DisplayServerNone is a text or background session, or a platform
+	// without X11 and Wayland.
+	DisplayServerNone    DisplayServer = ""
+	DisplayServerX11     DisplayServer = "x11"
+	DisplayServerWayland DisplayServer = "wayland"
+)
+
+// displayServer maps a graphical session type.
+func (t SessionType) displayServer() DisplayServer {
+	switch t {
+	case SessionTypeX11:
+		return DisplayServerX11
+	case SessionTypeWayland:
+		return DisplayServerWayland
+	}
+	return DisplayServerNone
+}
+
+// SessionInfo describes a login session. Fields the platform does not know
+// are left empty.
+type SessionInfo struct {
+	// User is the login name.
+	User string
+	// ID is the logind session ID or the Windows session ID.
+	ID string
+	// Seat is the logind seat, e.g. "seat0", or the Windows station name,
+	// e.g. "Console" or "RDP-Tcp#0".
+	Seat string
+	// Type is empty on Windows.
+	Type SessionType
+	// DisplayServer is X11 or Wayland. For the caller's session the
+	// environment takes precedence over Type: an X11 session type with
+	// WAYLAND_DISPLAY set is reported as Wayland.
+	DisplayServer DisplayServer
+	// Class is the logind session class: "user", "greeter", "lock-screen"
+	// or "background".
+	Class     string
+	LogonTime time.Time
+	// Active is set for the session in the foreground of its seat, or the
+	// connected Windows session.
+	Active bool
+	Locked bool
+	Remote bool
+	// RemoteHost is the host name or address of a remote client.
+	RemoteHost string
+	// ClientName is the name the remote client reports, Windows only.
+	ClientName string
+}
+
+// SessionRef identifies the session of an event reported by a backend that
+// watches all sessions of the machine.
+type SessionRef struct {
+	ID   string
+	UID  int
+	User string
+	Seat string
+}
+
+// RemoteSession is the verdict of DetectRemoteSession.
+type RemoteSession struct {
+	Remote bool
+	// Protocol is "ssh", "rdp", "x2go", "nx", "vnc" or "ard", empty when
+	// unknown.
+	Protocol string
+	// Client is the address or host name of the remote client.
+	Client string
+	// Evidence lists what the verdict is based on, e.g.
+	// "logind Remote=true" or "SSH_CONNECTION".
+	Evidence []string
+}
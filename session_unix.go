@@ -0,0 +1,146 @@
+//go:build linux
+
+package notify_lock_session
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+)
+
+// CurrentSession describes the logind session of the caller.
+func CurrentSession() (SessionInfo, error) {
+	ctx := context.Background()
+	conn, err := connectBus("system")
+	if err != nil {
+		return SessionInfo{}, err
+	}
+	defer func() { _ = conn.Close() }()
+
+	info, err := logindSessionInfo(ctx, conn, logindSessionPath(ctx, conn))
+	if err != nil {
+		return SessionInfo{}, err
+	}
+	info.DisplayServer = displayServer(func() SessionType { return info.Type })
+	return info, nil
+}
+
+// ListSessions describes all logind sessions of the machine.
+func ListSessions() ([]SessionInfo, error) {
+	ctx := context.Background()
+	conn, err := connectBus("system")
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = conn.Close() }()
+
+	return logindSessions(ctx, conn)
+}
+
+// logindSession is an entry of the logind ListSessions reply.
+type logindSession struct {
+	ID   string
+	UID  uint32
+	User string
+	Seat string
+	Path dbus.ObjectPath
+}
+
+func logindListSessions(ctx context.Context, conn *dbus.Conn) ([]logindSession, error) {
+	var list []logindSession
+	err := conn.Object(logindDest, logindPath).CallWithContext(ctx, logindManagerIface+".ListSessions", 0).Store(&list)
+	if err != nil {
+		return nil, fmt.Errorf("logind ListSessions: %w", err)
+	}
+	return list, nil
+}
+
+func logindSessions(ctx context.Context, conn *dbus.Conn) ([]SessionInfo, error) {
+	list, err := logindListSessions(ctx, conn)
+	if err != nil {
+		return nil, err
+	}
+	sessions := make([]SessionInfo, 0, len(list))
+	for _, s := range list {
+		info, err := logindSessionInfo(ctx, conn, s.Path)
+		if err != nil {
+			// Сессия могла завершиться после ListSessions.
+			continue
+		}
+		sessions = append(sessions, info)
+	}
+	return sessions, nil
+}
+
+// displayServer detects the display server of the caller from
+// WAYLAND_DISPLAY, XDG_SESSION_TYPE, the logind session type and DISPLAY,
+// in that order. DISPLAY alone may be XWayland, so it comes last.
+func displayServer(logindType func() SessionType) DisplayServer {
+	if os.Getenv("WAYLAND_DISPLAY") != "" {
+		return DisplayServerWayland
+	}
+	if ds := SessionType(os.Getenv("XDG_SESSION_TYPE")).displayServer(); ds != DisplayServerNone {
+		return ds
+	}
+	if ds := logindType().displayServer(); ds != DisplayServerNone {
+		return ds
+	}
+	if os.Getenv("DISPLAY") != "" {
+		return DisplayServerX11
+	}
+	return DisplayServerNone
+}
+
+// logindSessionType reads the type of the caller's logind session,
+// SessionTypeUnspecified when logind is not available.
+func logindSessionType(ctx context.Context) SessionType {
+	conn, err := connectBus("system")
+	if err != nil {
+		return SessionTypeUnspecified
+	}
+	defer func() { _ = conn.Close() }()
+
+	var t string
+	err = conn.Object(logindDest, logindSessionPath(ctx, conn)).StoreProperty(logindSessionIface+".Type", &t)
+	if err != nil {
+		return SessionTypeUnspecified
+	}
+	return SessionType(t)
+}
+
+// logindSessionInfo reads the properties of the logind session at path.
+func logindSessionInfo(ctx context.Context, conn *dbus.Conn, path dbus.ObjectPath) (SessionInfo, error) {
+	var props map[string]dbus.Variant
+	err := conn.Object(logindDest, path).CallWithContext(ctx, propertiesIface+".GetAll", 0, logindSessionIface).Store(&props)
+	if err != nil {
+		return SessionInfo{}, fmt.Errorf("logind session %s: %w", path, err)
+	}
+
+	info := SessionInfo{
+		User:       stringProp(props, "Name"),
+		ID:         stringProp(props, "Id"),
+		Type:       SessionType(stringProp(props, "Type")),
+		Class:      stringProp(props, "Class"),
+		RemoteHost: stringProp(props, "RemoteHost"),
+	}
+	info.DisplayServer = info.Type.displayServer()
+	info.Active, _ = props["Active"].Value().(bool)
+	info.Locked, _ = props["LockedHint"].Value().(bool)
+	info.Remote, _ = props["Remote"].Value().(bool)
+	// Seat - структура (so), у сессий без места ID пустой.
+	if seat, ok := props["Seat"].Value().([]interface{}); ok && len(seat) == 2 {
+		info.Seat, _ = seat[0].(string)
+	}
+	if usec, ok := props["Timestamp"].Value().(uint64); ok && usec > 0 {
+		info.LogonTime = time.UnixMicro(int64(usec))
+	}
+	return info, nil
+}
+
+func stringProp(props map[string]dbus.Variant, name string) string {
+	s, _ := props[name].Value().(string)
+	return s
+}
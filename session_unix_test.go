@@ -0,0 +1,99 @@
+//go:build linux
+
+package notify_lock_session
+
+import "testing"
+
+func TestCurrentSession(t *testing.T) {
+	address := startTestBus(t)
+	t.Setenv("DBUS_SYSTEM_BUS_ADDRESS", address)
+	t.Setenv("XDG_SESSION_ID", "c1")
+	clearDisplayEnv(t)
+	newFakeLogind(t, address)
+
+	info, err := CurrentSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := SessionInfo{
+		User:          "alice",
+		ID:            "c1",
+		Seat:          "seat0",
+		Type:          SessionTypeX11,
+		DisplayServer: DisplayServerX11,
+		Class:         "user",
+		Active:        true,
+	}
+	logon := info.LogonTime
+	info.LogonTime = want.LogonTime
+	if info != want {
+		t.Errorf("CurrentSession() = %+v, want %+v", info, want)
+	}
+	if !logon.Equal(testLogonTime) {
+		t.Errorf("LogonTime = %v, want %v", logon, testLogonTime)
+	}
+
+	// Окружение точнее типа сессии logind.
+	t.Setenv("WAYLAND_DISPLAY", "wayland-0")
+	if info, _ = CurrentSession(); info.DisplayServer != DisplayServerWayland {
+		t.Errorf("WAYLAND_DISPLAY: DisplayServer = %q", info.DisplayServer)
+	}
+}
+
+func clearDisplayEnv(t *testing.T) {
+	for _, name := range []string{"WAYLAND_DISPLAY", "XDG_SESSION_TYPE", "DISPLAY"} {
+		t.Setenv(name, "")
+	}
+}
+
+func TestDisplayServer(t *testing.T) {
+	tests := []struct {
+		wayland, sessionType, display string
+		logind                        SessionType
+		want                          DisplayServer
+	}{
+		{"wayland-0", "", "", SessionTypeUnspecified, DisplayServerWayland},
+		{"wayland-0", "x11", ":0", SessionTypeX11, DisplayServerWayland},
+		{"", "wayland", ":0", SessionTypeUnspecified, DisplayServerWayland},
+		{"", "", "", SessionTypeWayland, DisplayServerWayland},
+		{"", "x11", "", SessionTypeWayland, DisplayServerX11},
+		// XWayland без WAYLAND_DISPLAY в окружении.
+		{"", "", ":0", SessionTypeWayland, DisplayServerWayland},
+		{"", "", ":0", SessionTypeUnspecified, DisplayServerX11},
+		{"", "tty", "", SessionTypeTTY, DisplayServerNone},
+	}
+	for _, tt := range tests {
+		t.Setenv("WAYLAND_DISPLAY", tt.wayland)
+		t.Setenv("XDG_SESSION_TYPE", tt.sessionType)
+		t.Setenv("DISPLAY", tt.display)
+		if got := displayServer(func() SessionType { return tt.logind }); got != tt.want {
+			t.Errorf("displayServer(%+v) = %q, want %q", tt, got, tt.want)
+		}
+	}
+}
+
+func TestListSessions(t *testing.T) {
+	address := startTestBus(t)
+	t.Setenv("DBUS_SYSTEM_BUS_ADDRESS", address)
+	fake := newFakeLogind(t, address)
+	fake.setLockedHint(true)
+
+	sessions, err := ListSessions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// c2 не экспортирована, как завершившаяся сессия.
+	if len(sessions) != 1 || sessions[0].ID != "c1" || !sessions[0].Locked || !sessions[0].Active {
+		t.Fatalf("ListSessions() = %+v", sessions)
+	}
+
+	exportSession(t, fake, testSession2Path, SessionRef{ID: "c2", UID: 1001, User: "bob"})
+	sessions, err = ListSessions()
+	if err != nil || len(sessions) != 2 {
+		t.Fatalf("ListSessions() = %+v, %v", sessions, err)
+	}
+	bob := sessions[1]
+	if bob.User != "bob" || bob.Seat != "" || !bob.Remote || bob.RemoteHost != "198.51.100.4" || bob.Active || bob.Locked {
+		t.Errorf("remote session = %+v", bob)
+	}
+}
@@ -0,0 +1,266 @@
+//go:build linux
+
+package notify_lock_session
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sort"
+
+	"github.com/godbus/dbus/v5"
+)
+
+// BackendLogindSessions watches the lock state of every logind session of
+// the machine, not just the caller's. It is meant for system services
+// running as root.
+const BackendLogindSessions = "logind-sessions"
+
+// LogindSessionsBackend follows SessionNew and SessionRemoved of logind and
+// watches Lock, Unlock and LockedHint of each session. Every event carries
+// Lock.Session; instead of one initial state a snapshot is sent for each
+// session. The state filter and the merge policies do not tell sessions
+// apart, so they are not meant to be combined with this backend.
+type LogindSessionsBackend struct {
+	baseBackend
+	// sessions are the watched sessions by object path. After Start only
+	// the watch goroutine uses them.
+	sessions map[dbus.ObjectPath]*SessionRef
+	// changes are the sessions created and removed while the bus was gone,
+	// sent before the snapshots of the resync.
+	changes []Lock
+}
+
+func NewLogindSessionsBackend() *LogindSessionsBackend {
+	return &LogindSessionsBackend{}
+}
+
+func (b *LogindSessionsBackend) Name() string { return BackendLogindSessions }
+
+func (b *LogindSessionsBackend) Capabilities() Capability { return CapLock | CapSession }
+
+// State is not supported, the sessions have no common state.
+func (b *LogindSessionsBackend) State(ctx context.Context) (Lock, error) {
+	return Lock{}, errors.New("all sessions: state query is not supported, see the snapshots of Subscribe")
+}
+
+func (b *LogindSessionsBackend) Start(ctx context.Context, events chan<- Lock) error {
+	var conn *dbus.Conn
+	w := &signalWatch{
+		dial: func() (*dbus.Conn, error) { return connectBus("system") },
+		name: logindDest,
+		event: func(s *dbus.Signal) (Lock, bool) {
+			return b.event(ctx, conn, s)
+		},
+		snapshots: b.snapshots,
+	}
+	w.subscribe = func(ctx context.Context, c *dbus.Conn) error {
+		conn = c
+		return b.subscribe(ctx, c)
+	}
+	if err := w.open(ctx); err != nil {
+		return err
+	}
+	// event видит этот же ctx.
+	ctx = b.watch(ctx)
+
+	go func() {
+		states, err := b.snapshots(ctx, conn)
+		if err != nil {
+			slog.Warn("Initial session state", slog.Any("error", err))
+		}
+		for _, l := range states {
+			if !send(ctx, events, l) {
+				return
+			}
+		}
+		w.run(ctx, events, b.setErr)
+	}()
+	return nil
+}
+
+// subscribe follows the manager and watches the current sessions. After a
+// reconnect the sessions that came and went meanwhile are kept in changes.
+func (b *LogindSessionsBackend) subscribe(ctx context.Context, conn *dbus.Conn) error {
+	err := conn.AddMatchSignal(
+		dbus.WithMatchSender(logindDest),
+		dbus.WithMatchObjectPath(logindPath),
+		dbus.WithMatchInterface(logindManagerIface),
+	)
+	if err != nil {
+		return fmt.Errorf("subscribe on logind sessions: %w", err)
+	}
+	list, err := logindListSessions(ctx, conn)
+	if err != nil {
+		return err
+	}
+	prev := b.sessions
+	b.sessions = map[dbus.ObjectPath]*SessionRef{}
+	for _, s := range list {
+		ref := &SessionRef{ID: s.ID, UID: int(s.UID), User: s.User, Seat: s.Seat}
+		if err := b.watchSession(conn, s.Path, ref); err != nil {
+			b.sessions = prev
+			return err
+		}
+	}
+	if prev != nil {
+		b.changes = append(b.changes, sessionChanges(prev, b.sessions)...)
+	}
+	return nil
+}
+
+// sessionChanges returns EventSessionTerminate for the sessions of prev that
+// are gone and EventSessionCreate for the new ones, each ordered by ID.
+func sessionChanges(prev, cur map[dbus.ObjectPath]*SessionRef) []Lock {
+	var removed, created []*SessionRef
+	for path, ref := range prev {
+		if _, ok := cur[path]; !ok {
+			removed = append(removed, ref)
+		}
+	}
+	for path, ref := range cur {
+		if _, ok := prev[path]; !ok {
+			created = append(created, ref)
+		}
+	}
+	var res []Lock
+	for _, c := range []struct {
+		kind EventKind
+		refs []*SessionRef
+	}{{EventSessionTerminate, removed}, {EventSessionCreate, created}} {
+		sort.Slice(c.refs, func(i, j int) bool { return c.refs[i].ID < c.refs[j].ID })
+		for _, ref := range c.refs {
+			l := newLock(c.kind, BackendLogindSessions, "ListSessions")
+			l.Session = ref
+			res = append(res, l)
+		}
+	}
+	return res
+}
+
+// sessionMatches are the match rules of the session at path.
+func sessionMatches(path dbus.ObjectPath) [][]dbus.MatchOption {
+	return [][]dbus.MatchOption{
+		{
+			dbus.WithMatchSender(logindDest),
+			dbus.WithMatchObjectPath(path),
+			dbus.WithMatchInterface(logindSessionIface),
+		},
+		{
+			dbus.WithMatchSender(logindDest),
+			dbus.WithMatchObjectPath(path),
+			dbus.WithMatchInterface(propertiesIface),
+			dbus.WithMatchMember("PropertiesChanged"),
+			dbus.WithMatchArg(0, logindSessionIface),
+		},
+	}
+}
+
+func (b *LogindSessionsBackend) watchSession(conn *dbus.Conn, path dbus.ObjectPath, ref *SessionRef) error {
+	for _, opts := range sessionMatches(path) {
+		if err := conn.AddMatchSignal(opts...); err != nil {
+			return fmt.Errorf("subscribe on logind session %s: %w", path, err)
+		}
+	}
+	b.sessions[path] = ref
+	return nil
+}
+
+func (b *LogindSessionsBackend) unwatchSession(conn *dbus.Conn, path dbus.ObjectPath) {
+	for _, opts := range sessionMatches(path) {
+		if err := conn.RemoveMatchSignal(opts...); err != nil {
+			slog.Warn("Unsubscribe from logind session", slog.String("path", string(path)), slog.Any("error", err))
+		}
+	}
+	delete(b.sessions, path)
+}
+
+// snapshots returns the pending changes, then the LockedHint of each
+// watched session ordered by session ID.
+func (b *LogindSessionsBackend) snapshots(ctx context.Context, conn *dbus.Conn) ([]Lock, error) {
+	states := b.changes
+	b.changes = nil
+	paths := make([]dbus.ObjectPath, 0, len(b.sessions))
+	for path := range b.sessions {
+		paths = append(paths, path)
+	}
+	sort.Slice(paths, func(i, j int) bool { return b.sessions[paths[i]].ID < b.sessions[paths[j]].ID })
+
+	var errs []error
+	for _, path := range paths {
+		l, err := logindLockedHint(conn, path)
+		if err != nil {
+			// Сессия могла завершиться, SessionRemoved ещё в пути.
+			errs = append(errs, err)
+			continue
+		}
+		states = append(states, b.tag(l, path))
+	}
+	return states, errors.Join(errs...)
+}
+
+func (b *LogindSessionsBackend) tag(l Lock, path dbus.ObjectPath) Lock {
+	l.Backend = BackendLogindSessions
+	l.Session = b.sessions[path]
+	return l
+}
+
+func (b *LogindSessionsBackend) event(ctx context.Context, conn *dbus.Conn, s *dbus.Signal) (Lock, bool) {
+	switch s.Name {
+	case logindManagerIface + ".SessionNew", logindManagerIface + ".SessionRemoved":
+		if s.Path != logindPath || len(s.Body) < 2 {
+			return Lock{}, false
+		}
+		path, ok := s.Body[1].(dbus.ObjectPath)
+		if !ok {
+			return Lock{}, false
+		}
+		if s.Name == logindManagerIface+".SessionRemoved" {
+			l := b.tag(newLock(EventSessionTerminate, BackendLogindSessions, s.Name), path)
+			if l.Session == nil {
+				return Lock{}, false
+			}
+			b.unwatchSession(conn, path)
+			return l, true
+		}
+		ref, err := logindSessionRef(ctx, conn, path)
+		if err == nil {
+			err = b.watchSession(conn, path, ref)
+		}
+		if err != nil {
+			slog.Warn("Watch new logind session", slog.String("path", string(path)), slog.Any("error", err))
+			return Lock{}, false
+		}
+		return b.tag(newLock(EventSessionCreate, BackendLogindSessions, s.Name), path), true
+	}
+
+	if _, ok := b.sessions[s.Path]; !ok {
+		return Lock{}, false
+	}
+	l, ok := logindEvent(s)
+	if !ok {
+		return Lock{}, false
+	}
+	return b.tag(l, s.Path), true
+}
+
+// logindSessionRef reads the identity of the logind session at path.
+func logindSessionRef(ctx context.Context, conn *dbus.Conn, path dbus.ObjectPath) (*SessionRef, error) {
+	var props map[string]dbus.Variant
+	err := conn.Object(logindDest, path).CallWithContext(ctx, propertiesIface+".GetAll", 0, logindSessionIface).Store(&props)
+	if err != nil {
+		return nil, fmt.Errorf("logind session %s: %w", path, err)
+	}
+	ref := &SessionRef{ID: stringProp(props, "Id"), User: stringProp(props, "Name")}
+	// User и Seat - структуры (uo) и (so).
+	if user, ok := props["User"].Value().([]interface{}); ok && len(user) == 2 {
+		if uid, ok := user[0].(uint32); ok {
+			ref.UID = int(uid)
+		}
+	}
+	if seat, ok := props["Seat"].Value().([]interface{}); ok && len(seat) == 2 {
+		ref.Seat, _ = seat[0].(string)
+	}
+	return ref, nil
+}
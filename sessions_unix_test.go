@@ -0,0 +1,158 @@
+//go:build linux
+
+package notify_lock_session
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+	"github.com/godbus/dbus/v5/prop"
+)
+
+// exportSession exports another session of the fake logind.
+func exportSession(t *testing.T, f *fakeLogind, path dbus.ObjectPath, ref SessionRef) *prop.Properties {
+	t.Helper()
+	user := struct {
+		UID  uint32
+		Path dbus.ObjectPath
+	}{uint32(ref.UID), "/org/freedesktop/login1/user/_" + dbus.ObjectPath(strconv.Itoa(ref.UID))}
+	seat := struct {
+		ID   string
+		Path dbus.ObjectPath
+	}{ref.Seat, "/"}
+	props, err := prop.Export(f.conn, path, prop.Map{
+		logindSessionIface: {
+			"Id":         {Value: ref.ID, Emit: prop.EmitFalse},
+			"Name":       {Value: ref.User, Emit: prop.EmitFalse},
+			"User":       {Value: user, Emit: prop.EmitFalse},
+			"Seat":       {Value: seat, Emit: prop.EmitFalse},
+			"Class":      {Value: "user", Emit: prop.EmitFalse},
+			"Type":       {Value: "tty", Emit: prop.EmitFalse},
+			"Remote":     {Value: true, Emit: prop.EmitFalse},
+			"RemoteHost": {Value: "198.51.100.4", Emit: prop.EmitFalse},
+			"Active":     {Value: false, Emit: prop.EmitFalse},
+			"LockedHint": {Value: false, Emit: prop.EmitTrue},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return props
+}
+
+func expectSession(t *testing.T, lock chan Lock, kind EventKind, ref SessionRef) Lock {
+	t.Helper()
+	l := receive(t, lock)
+	if l.Kind != kind || l.Backend != BackendLogindSessions || l.Session == nil || *l.Session != ref {
+		t.Fatalf("got %+v (session %+v), want %v of %+v", l, l.Session, kind, ref)
+	}
+	return l
+}
+
+func TestLogindSessionsBackend(t *testing.T) {
+	address := startTestBus(t)
+	t.Setenv("DBUS_SYSTEM_BUS_ADDRESS", address)
+	fake := newFakeLogind(t, address)
+	alice := SessionRef{ID: "c1", UID: 1000, User: "alice", Seat: "seat0"}
+	bob := SessionRef{ID: "c2", UID: 1001, User: "bob"}
+	bobProps := exportSession(t, fake, testSession2Path, bob)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	lock := make(chan Lock, 10)
+	if err := New(WithBackend(BackendLogindSessions)).Subscribe(ctx, lock); err != nil {
+		t.Fatal(err)
+	}
+	if l := expectSession(t, lock, EventUnlocked, alice); !l.Snapshot {
+		t.Errorf("snapshot = %+v", l)
+	}
+	expectSession(t, lock, EventUnlocked, bob)
+
+	bobProps.SetMust(logindSessionIface, "LockedHint", true)
+	expectSession(t, lock, EventLocked, bob)
+	fake.emit(t, "Lock")
+	expectSession(t, lock, EventLocked, alice)
+
+	carol := SessionRef{ID: "c3", UID: 1002, User: "carol", Seat: "seat0"}
+	carolPath := dbus.ObjectPath("/org/freedesktop/login1/session/c3")
+	exportSession(t, fake, carolPath, carol)
+	fake.emitManager(t, "SessionNew", "c3", carolPath)
+	expectSession(t, lock, EventSessionCreate, carol)
+	if err := fake.conn.Emit(carolPath, logindSessionIface+".Lock"); err != nil {
+		t.Fatal(err)
+	}
+	expectSession(t, lock, EventLocked, carol)
+
+	fake.emitManager(t, "SessionRemoved", "c3", carolPath)
+	expectSession(t, lock, EventSessionTerminate, carol)
+	// Завершённая сессия больше не отслеживается.
+	if err := fake.conn.Emit(carolPath, logindSessionIface+".Unlock"); err != nil {
+		t.Fatal(err)
+	}
+	fake.emit(t, "Unlock")
+	expectSession(t, lock, EventUnlocked, alice)
+
+	select {
+	case l := <-lock:
+		t.Errorf("unexpected event %+v", l)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestLogindSessionsReconnect(t *testing.T) {
+	dir := t.TempDir()
+	address, daemon := startTestBusIn(t, dir)
+	t.Setenv("DBUS_SYSTEM_BUS_ADDRESS", address)
+	fake := newFakeLogind(t, address)
+	alice := SessionRef{ID: "c1", UID: 1000, User: "alice", Seat: "seat0"}
+	bob := SessionRef{ID: "c2", UID: 1001, User: "bob"}
+	carol := SessionRef{ID: "c3", UID: 1002, User: "carol", Seat: "seat0"}
+	carolPath := dbus.ObjectPath("/org/freedesktop/login1/session/c3")
+	exportSession(t, fake, testSession2Path, bob)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	lock := make(chan Lock, 10)
+	nl := New(WithBackend(BackendLogindSessions))
+	if err := nl.Subscribe(ctx, lock); err != nil {
+		t.Fatal(err)
+	}
+	expectSession(t, lock, EventUnlocked, alice)
+	expectSession(t, lock, EventUnlocked, bob)
+
+	exportSession(t, fake, carolPath, carol)
+	fake.emitManager(t, "SessionNew", "c3", carolPath)
+	expectSession(t, lock, EventSessionCreate, carol)
+	fake.emitManager(t, "SessionRemoved", "c2", testSession2Path)
+	expectSession(t, lock, EventSessionTerminate, bob)
+
+	_ = daemon.Process.Kill()
+	_ = daemon.Wait()
+	deadline := time.Now().Add(5 * time.Second)
+	for nl.Err() == nil {
+		if time.Now().After(deadline) {
+			t.Fatal("Err() did not report the closed connection")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// Пока шины не было, c3 завершилась, а c2 снова появилась.
+	startTestBusIn(t, dir)
+	newFakeLogind(t, address)
+
+	for _, want := range []struct {
+		kind EventKind
+		ref  SessionRef
+	}{
+		{EventSessionTerminate, carol},
+		{EventSessionCreate, bob},
+		{EventUnlocked, alice},
+	} {
+		if l := expectSession(t, lock, want.kind, want.ref); !l.Resynced {
+			t.Errorf("after reconnect: %+v", l)
+		}
+	}
+}
@@ -0,0 +1,8 @@
+//go:build linux && (386 || arm)
+
+package notify_lock_session
+
+import "syscall"
+
+// Вызов без суффикса 32 принимает только 16-битные uid.
+const sysSetresuid = syscall.SYS_SETRESUID32
@@ -0,0 +1,7 @@
+//go:build linux && !386 && !arm
+
+package notify_lock_session
+
+import "syscall"
+
+const sysSetresuid = syscall.SYS_SETRESUID
@@ -0,0 +1,41 @@
+package notify_lock_session
+
+// BackendSignal is the default name of the backends created by
+// WithSignalSource.
+const BackendSignal = "signal"
+
+// SignalSource describes a D-Bus signal of a locker that is not built in.
+// Empty match fields match anything.
+type SignalSource struct {
+	// Name is reported in Lock.Backend, BackendSignal when empty.
+	Name string
+	// Bus is "session" (default), "system", a bus address or UserBus(uid).
+	Bus       string
+	Sender    string
+	Path      string
+	Interface string
+	Member    string
+	// Decode tells how the signal body maps to the locked state, e.g.
+	// "arg0 bool", "arg1 variant, key LockedHint" or
+	// "uint32 non-zero means locked". See ParseDecoder.
+	Decode string
+	// ScreenSaver reports the state as screensaver start/stop instead of
+	// lock/unlock.
+	ScreenSaver bool
+}
+
+// WithSignalSource adds a backend for each source. An invalid source is
+// reported by Subscribe and State. D-Bus sources are supported on Linux
+// only.
+func WithSignalSource(sources ...SignalSource) Option {
+	return func(l *NotifyLock) {
+		for _, src := range sources {
+			b, err := newSignalBackend(src)
+			if err != nil {
+				l.errs = append(l.errs, err)
+				continue
+			}
+			l.instances = append(l.instances, b)
+		}
+	}
+}
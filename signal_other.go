@@ -0,0 +1,9 @@
+//go:build !linux
+
+package notify_lock_session
+
+import "fmt"
+
+func newSignalBackend(src SignalSource) (Backend, error) {
+	return nil, fmt.Errorf("%w: D-Bus signal source %s.%s", ErrUnknownBackend, src.Interface, src.Member)
+}
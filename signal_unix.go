@@ -0,0 +1,259 @@
+//go:build linux
+
+package notify_lock_session
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/godbus/dbus/v5"
+)
+
+// Decoder maps the body of a signal to the locked state.
+type Decoder struct {
+	arg int
+	// typ is the expected type of the value, empty for any.
+	typ string
+	key string
+	// cond is "true", "false", "non-zero", "zero" or "equals".
+	cond   string
+	equals string
+}
+
+// ParseDecoder parses a decoder spec. The words, separated by spaces or
+// commas, are:
+//
+//	argN                  the argument to decode, arg0 by default
+//	bool, byte, int16, uint16, int32, uint32, int64, uint64, string, variant
+//	                      the expected type; variants are always unwrapped
+//	key NAME              the entry of a dictionary (a{sv}) argument
+//	true, false, non-zero, zero, equals VALUE
+//	                      the value that means locked, true for bool and
+//	                      non-zero for numbers by default
+//
+// "means" and "locked" may be used for readability: "uint32 non-zero means
+// locked".
+func ParseDecoder(spec string) (Decoder, error) {
+	var d Decoder
+	words := strings.Fields(strings.ReplaceAll(spec, ",", " "))
+	if len(words) == 0 {
+		return d, errors.New("empty decoder")
+	}
+	for i := 0; i < len(words); i++ {
+		w := words[i]
+		switch w {
+		case "bool", "byte", "int16", "uint16", "int32", "uint32", "int64", "uint64", "string", "variant":
+			d.typ = w
+		case "true", "false", "non-zero", "zero":
+			d.cond = w
+		case "key", "equals":
+			if i+1 == len(words) {
+				return d, fmt.Errorf("decoder %q: %s needs a value", spec, w)
+			}
+			i++
+			if w == "key" {
+				d.key = words[i]
+			} else {
+				d.cond, d.equals = w, words[i]
+			}
+		case "means", "locked":
+		default:
+			n, err := strconv.Atoi(strings.TrimPrefix(w, "arg"))
+			if !strings.HasPrefix(w, "arg") || err != nil || n < 0 {
+				return d, fmt.Errorf("decoder %q: unexpected %q", spec, w)
+			}
+			d.arg = n
+		}
+	}
+	if d.cond == "" {
+		switch d.typ {
+		case "string":
+			return d, fmt.Errorf("decoder %q: string needs equals", spec)
+		case "bool", "variant", "":
+			d.cond = "true"
+		default:
+			d.cond = "non-zero"
+		}
+	}
+	return d, nil
+}
+
+// Decode returns the locked state, ok is false when the body does not hold
+// the expected value.
+func (d Decoder) Decode(body []interface{}) (locked bool, ok bool) {
+	if d.arg >= len(body) {
+		return false, false
+	}
+	v := body[d.arg]
+	if d.key != "" {
+		if dict, ok := v.(dbus.Variant); ok {
+			v = dict.Value()
+		}
+		dict, ok := v.(map[string]dbus.Variant)
+		if !ok {
+			return false, false
+		}
+		entry, ok := dict[d.key]
+		if !ok {
+			return false, false
+		}
+		v = entry
+	}
+	if variant, ok := v.(dbus.Variant); ok {
+		v = variant.Value()
+	}
+	if d.typ != "" && d.typ != "variant" && dbus.SignatureOf(v) != typeSignature[d.typ] {
+		return false, false
+	}
+
+	switch v := v.(type) {
+	case bool:
+		switch d.cond {
+		case "true":
+			return v, true
+		case "false":
+			return !v, true
+		}
+	case string:
+		if d.cond == "equals" {
+			return v == d.equals, true
+		}
+	default:
+		n, isNumber := number(v)
+		switch {
+		case !isNumber:
+		case d.cond == "non-zero", d.cond == "true":
+			return n != 0, true
+		case d.cond == "zero", d.cond == "false":
+			return n == 0, true
+		case d.cond == "equals":
+			return strconv.FormatInt(n, 10) == d.equals, true
+		}
+	}
+	return false, false
+}
+
+var typeSignature = map[string]dbus.Signature{
+	"bool":   dbus.SignatureOf(false),
+	"byte":   dbus.SignatureOf(byte(0)),
+	"int16":  dbus.SignatureOf(int16(0)),
+	"uint16": dbus.SignatureOf(uint16(0)),
+	"int32":  dbus.SignatureOf(int32(0)),
+	"uint32": dbus.SignatureOf(uint32(0)),
+	"int64":  dbus.SignatureOf(int64(0)),
+	"uint64": dbus.SignatureOf(uint64(0)),
+	"string": dbus.SignatureOf(""),
+}
+
+func number(v interface{}) (int64, bool) {
+	switch v := v.(type) {
+	case byte:
+		return int64(v), true
+	case int16:
+		return int64(v), true
+	case uint16:
+		return int64(v), true
+	case int32:
+		return int64(v), true
+	case uint32:
+		return int64(v), true
+	case int64:
+		return v, true
+	case uint64:
+		return int64(v), true
+	}
+	return 0, false
+}
+
+// SignalBackend watches a signal described by a SignalSource.
+type SignalBackend struct {
+	baseBackend
+	src     SignalSource
+	decoder Decoder
+}
+
+// NewSignalBackend validates src and parses its decoder.
+func NewSignalBackend(src SignalSource) (*SignalBackend, error) {
+	if src.Interface == "" || src.Member == "" {
+		return nil, errors.New("signal source needs an interface and a member")
+	}
+	if src.Path != "" && !dbus.ObjectPath(src.Path).IsValid() {
+		return nil, fmt.Errorf("signal source: invalid path %q", src.Path)
+	}
+	d, err := ParseDecoder(src.Decode)
+	if err != nil {
+		return nil, fmt.Errorf("signal source %s.%s: %w", src.Interface, src.Member, err)
+	}
+	return &SignalBackend{src: src, decoder: d}, nil
+}
+
+func newSignalBackend(src SignalSource) (Backend, error) {
+	return NewSignalBackend(src)
+}
+
+func (b *SignalBackend) Name() string {
+	if b.src.Name != "" {
+		return b.src.Name
+	}
+	return BackendSignal
+}
+
+func (b *SignalBackend) Capabilities() Capability {
+	if b.src.ScreenSaver {
+		return CapScreenSaver
+	}
+	return CapLock
+}
+
+// State is not supported, signals only report transitions.
+func (b *SignalBackend) State(ctx context.Context) (Lock, error) {
+	return Lock{}, fmt.Errorf("%s.%s: state query is not supported", b.src.Interface, b.src.Member)
+}
+
+func (b *SignalBackend) Start(ctx context.Context, events chan<- Lock) error {
+	w := &signalWatch{
+		dial:  func() (*dbus.Conn, error) { return connectBus(b.src.Bus) },
+		event: b.event,
+		name:  b.src.Sender,
+	}
+	opts := []dbus.MatchOption{
+		dbus.WithMatchInterface(b.src.Interface),
+		dbus.WithMatchMember(b.src.Member),
+	}
+	if b.src.Sender != "" {
+		opts = append(opts, dbus.WithMatchSender(b.src.Sender))
+	}
+	if b.src.Path != "" {
+		opts = append(opts, dbus.WithMatchObjectPath(dbus.ObjectPath(b.src.Path)))
+		w.paths = []dbus.ObjectPath{dbus.ObjectPath(b.src.Path)}
+	}
+	w.subscribe = func(ctx context.Context, conn *dbus.Conn) error {
+		if err := conn.AddMatchSignal(opts...); err != nil {
+			return fmt.Errorf("subscribe on %s.%s: %w", b.src.Interface, b.src.Member, err)
+		}
+		return nil
+	}
+	if err := w.open(ctx); err != nil {
+		return err
+	}
+	go w.run(b.watch(ctx), events, b.setErr)
+	return nil
+}
+
+func (b *SignalBackend) event(s *dbus.Signal) (Lock, bool) {
+	if s.Name != b.src.Interface+"."+b.src.Member {
+		return Lock{}, false
+	}
+	locked, ok := b.decoder.Decode(s.Body)
+	if !ok {
+		return Lock{}, false
+	}
+	kind := lockedKind(locked)
+	if b.src.ScreenSaver {
+		kind = screenSaverKind(locked)
+	}
+	return newLock(kind, b.Name(), s.Name), true
+}
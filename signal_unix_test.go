@@ -0,0 +1,102 @@
+//go:build linux
+
+package notify_lock_session
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/godbus/dbus/v5"
+)
+
+func TestParseDecoder(t *testing.T) {
+	props := map[string]dbus.Variant{"LockedHint": dbus.MakeVariant(true)}
+	tests := []struct {
+		spec       string
+		body       []interface{}
+		locked, ok bool
+	}{
+		{"arg0 bool", []interface{}{true}, true, true},
+		{"arg0 bool", []interface{}{false}, false, true},
+		{"bool, false means locked", []interface{}{false}, true, true},
+		{"arg0 bool", []interface{}{uint32(1)}, false, false},
+		{"arg0 bool", nil, false, false},
+		{"arg1 variant, key LockedHint", []interface{}{"org.freedesktop.login1.Session", props}, true, true},
+		{"arg1 variant, key Active", []interface{}{"org.freedesktop.login1.Session", props}, false, false},
+		{"uint32 non-zero means locked", []interface{}{uint32(2)}, true, true},
+		{"uint32 non-zero means locked", []interface{}{uint32(0)}, false, true},
+		{"uint32 non-zero means locked", []interface{}{int32(2)}, false, false},
+		{"arg0 variant, zero means locked", []interface{}{dbus.MakeVariant(int64(0))}, true, true},
+		{"arg1 string, equals locked", []interface{}{0, "locked"}, true, true},
+		{"arg1 string, equals locked", []interface{}{0, "idle"}, false, true},
+	}
+	for _, tt := range tests {
+		d, err := ParseDecoder(tt.spec)
+		if err != nil {
+			t.Errorf("ParseDecoder(%q): %v", tt.spec, err)
+			continue
+		}
+		locked, ok := d.Decode(tt.body)
+		if locked != tt.locked || ok != tt.ok {
+			t.Errorf("%q.Decode(%v) = %v, %v, want %v, %v", tt.spec, tt.body, locked, ok, tt.locked, tt.ok)
+		}
+	}
+
+	for _, spec := range []string{"", "argx bool", "uint32 key", "string", "float"} {
+		if _, err := ParseDecoder(spec); err == nil {
+			t.Errorf("ParseDecoder(%q) accepted", spec)
+		}
+	}
+}
+
+func TestSignalBackend(t *testing.T) {
+	address := startTestBus(t)
+	owner := connectTestBus(t, address)
+	requestName(t, owner, "org.example.Locker")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	lock := make(chan Lock, 10)
+	nl := New(WithSignalSource(SignalSource{
+		Name:      "locker",
+		Bus:       address,
+		Sender:    "org.example.Locker",
+		Path:      "/org/example/Locker",
+		Interface: "org.example.Locker",
+		Member:    "StateChanged",
+		Decode:    "uint32 non-zero means locked",
+	}))
+	if err := nl.Subscribe(ctx, lock); err != nil {
+		t.Fatal(err)
+	}
+
+	emit := func(path dbus.ObjectPath, state uint32) {
+		t.Helper()
+		if err := owner.Emit(path, "org.example.Locker.StateChanged", state); err != nil {
+			t.Fatal(err)
+		}
+	}
+	emit("/org/example/Other", 1)
+	emit("/org/example/Locker", 1)
+	l := expectKind(t, lock, EventLocked, "org.example.Locker.StateChanged")
+	if l.Backend != "locker" || l.Snapshot {
+		t.Errorf("locked: %+v", l)
+	}
+	emit("/org/example/Locker", 0)
+	expectKind(t, lock, EventUnlocked, "org.example.Locker.StateChanged")
+}
+
+func TestSignalSourceError(t *testing.T) {
+	nl := New(WithSignalSource(SignalSource{Interface: "org.example.Locker", Member: "StateChanged", Decode: "float"}))
+	err := nl.Subscribe(context.Background(), make(chan Lock))
+	if err == nil {
+		t.Fatal("Subscribe accepted an invalid decoder")
+	}
+	if _, err = nl.State(context.Background()); err == nil {
+		t.Error("State accepted an invalid decoder")
+	}
+	if _, err = NewSignalBackend(SignalSource{Decode: "arg0 bool"}); err == nil || errors.Is(err, ErrUnknownBackend) {
+		t.Errorf("NewSignalBackend without a member: %v", err)
+	}
+}
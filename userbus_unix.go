@@ -0,0 +1,95 @@
+//go:build linux
+
+package notify_lock_session
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/godbus/dbus/v5"
+)
+
+// busUser parses a bus made by UserBus.
+func busUser(bus string) (uid int, ok bool) {
+	if !strings.HasPrefix(bus, userBusPrefix) {
+		return 0, false
+	}
+	uid, err := strconv.Atoi(strings.TrimPrefix(bus, userBusPrefix))
+	if err != nil || uid < 0 {
+		return -1, true
+	}
+	return uid, true
+}
+
+func userBusAddress(uid int) string {
+	return "unix:path=/run/user/" + strconv.Itoa(uid) + "/bus"
+}
+
+// dialAs connects to the bus at address and authenticates as uid with
+// EXTERNAL. The bus checks the peer credentials of the socket, so when uid
+// is not the effective user the socket is connected with the effective
+// uid switched on this thread only.
+func dialAs(address string, uid int) (*dbus.Conn, error) {
+	auth := []dbus.Auth{dbus.AuthExternal(strconv.Itoa(uid))}
+	euid := os.Geteuid()
+	if uid == euid {
+		return dbus.Connect(address, dbus.WithAuth(auth...))
+	}
+
+	type result struct {
+		conn *dbus.Conn
+		err  error
+	}
+	done := make(chan result, 1)
+	go func() {
+		// Учётные данные меняются только у этого потока. Если вернуть их
+		// не удалось, поток не разблокируется и завершится вместе с
+		// горутиной.
+		runtime.LockOSThread()
+		if err := setEUID(uid); err != nil {
+			runtime.UnlockOSThread()
+			done <- result{err: fmt.Errorf("switch to uid %d: %w", uid, err)}
+			return
+		}
+		conn, err := dbus.Dial(address)
+		if restore := setEUID(euid); restore != nil {
+			if conn != nil {
+				_ = conn.Close()
+			}
+			done <- result{err: fmt.Errorf("restore uid %d: %w", euid, restore)}
+			return
+		}
+		runtime.UnlockOSThread()
+		done <- result{conn, err}
+	}()
+	r := <-done
+	if r.err != nil {
+		return nil, r.err
+	}
+
+	conn := r.conn
+	if err := conn.Auth(auth); err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	if err := conn.Hello(); err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	return conn, nil
+}
+
+// setEUID changes the effective uid of the calling thread. syscall.Setresuid
+// would change it for the whole process.
+func setEUID(uid int) error {
+	keep := ^uintptr(0)
+	_, _, errno := syscall.RawSyscall(sysSetresuid, keep, uintptr(uid), keep)
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
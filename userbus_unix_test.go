@@ -0,0 +1,113 @@
+//go:build linux
+
+package notify_lock_session
+
+import (
+	"bufio"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+)
+
+const testUID = 65534
+
+func TestBusUser(t *testing.T) {
+	if uid, ok := busUser(UserBus(1000)); !ok || uid != 1000 {
+		t.Errorf("busUser(UserBus(1000)) = %d, %v", uid, ok)
+	}
+	if _, ok := busUser("system"); ok {
+		t.Error(`busUser("system") is a user bus`)
+	}
+	if _, err := connectBus("user:x"); err == nil {
+		t.Error(`connectBus("user:x") succeeded`)
+	}
+	if a := userBusAddress(1000); a != "unix:path=/run/user/1000/bus" {
+		t.Errorf("userBusAddress(1000) = %q", a)
+	}
+}
+
+// startUserBus runs dbus-daemon as testUID, like the session bus of that
+// user.
+func startUserBus(t *testing.T) string {
+	t.Helper()
+	if os.Geteuid() != 0 {
+		t.Skip("needs root to run a bus as another user")
+	}
+	daemon, err := exec.LookPath("dbus-daemon")
+	if err != nil {
+		t.Skip("dbus-daemon not found")
+	}
+	dir, err := os.MkdirTemp("", "userbus")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = os.RemoveAll(dir) })
+	config := filepath.Join(dir, "bus.conf")
+	socket := filepath.Join(dir, "bus")
+	err = os.WriteFile(config, []byte(strings.ReplaceAll(testBusConfig, "%SOCKET%", socket)), 0o644)
+	if err == nil {
+		err = os.Chmod(dir, 0o777)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cmd := exec.Command(daemon, "--config-file="+config, "--nofork", "--print-address")
+	cmd.SysProcAttr = &syscall.SysProcAttr{Credential: &syscall.Credential{Uid: testUID, Gid: testUID}}
+	out, err := cmd.StdoutPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = cmd.Start(); err != nil {
+		t.Skipf("start dbus-daemon as %d: %v", testUID, err)
+	}
+	t.Cleanup(func() {
+		_ = cmd.Process.Kill()
+		_ = cmd.Wait()
+	})
+
+	address := make(chan string, 1)
+	go func() {
+		line, _ := bufio.NewReader(out).ReadString('\n')
+		address <- strings.TrimSpace(line)
+	}()
+	select {
+	case a := <-address:
+		if a == "" {
+			t.Skip("dbus-daemon did not start as another user")
+		}
+		return a
+	case <-time.After(5 * time.Second):
+		t.Fatal("dbus-daemon did not report its address")
+	}
+	return ""
+}
+
+func TestDialAs(t *testing.T) {
+	address := startUserBus(t)
+
+	if conn, err := dbus.Connect(address); err == nil {
+		_ = conn.Close()
+		t.Skip("the bus accepts root, nothing to check")
+	}
+
+	conn, err := dialAs(address, testUID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = conn.Close() }()
+	var uid uint32
+	err = conn.BusObject().Call(busName+".GetConnectionUnixUser", 0, conn.Names()[0]).Store(&uid)
+	if err != nil || uid != testUID {
+		t.Errorf("connected as %d, %v", uid, err)
+	}
+	if euid := os.Geteuid(); euid != 0 {
+		t.Errorf("effective uid changed to %d", euid)
+	}
+}
@@ -0,0 +1,266 @@
+//go:build linux
+
+package notify_lock_session
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+)
+
+const (
+	busName          = "org.freedesktop.DBus"
+	nameOwnerChanged = busName + ".NameOwnerChanged"
+)
+
+// Задержки между попытками переподключения к шине.
+const (
+	reconnectMinDelay = 100 * time.Millisecond
+	reconnectMaxDelay = 30 * time.Second
+)
+
+// signalWatch is a D-Bus connection subscribed to the signals of a backend.
+// It reconnects when the bus goes away.
+type signalWatch struct {
+	// dial connects to the bus.
+	dial func() (*dbus.Conn, error)
+	// subscribe adds the match rules on a new connection.
+	subscribe func(ctx context.Context, conn *dbus.Conn) error
+	// event maps a received signal, ok is false for unrelated signals.
+	event func(s *dbus.Signal) (l Lock, ok bool)
+	// state queries the current state after a possible gap, nil when the
+	// source has no state.
+	state func(ctx context.Context, conn *dbus.Conn) (Lock, error)
+	// snapshots is used instead of state when the watch follows several
+	// sessions.
+	snapshots func(ctx context.Context, conn *dbus.Conn) ([]Lock, error)
+
+	// name is the service the signals must come from, owner its current
+	// unique name. Both are empty when the sender is not verified.
+	name  string
+	owner string
+	// paths are the object paths the signals must come from, any when empty.
+	paths []dbus.ObjectPath
+
+	conn    *dbus.Conn
+	signals chan *dbus.Signal
+}
+
+// connectBus connects to "session" (default), "system", a bus address or
+// the bus of a user, see UserBus.
+func connectBus(bus string) (*dbus.Conn, error) {
+	var (
+		conn *dbus.Conn
+		err  error
+	)
+	if bus == "" {
+		bus = "session"
+	}
+	switch uid, isUser := busUser(bus); {
+	case isUser && uid < 0:
+		err = errors.New("invalid uid")
+	case isUser:
+		conn, err = dialAs(userBusAddress(uid), uid)
+	case bus == "session":
+		conn, err = dbus.ConnectSessionBus()
+	case bus == "system":
+		conn, err = dbus.ConnectSystemBus()
+	default:
+		conn, err = dbus.Connect(bus)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("connect %s bus: %w", bus, err)
+	}
+	return conn, nil
+}
+
+// open connects and subscribes. The signal channel is registered before
+// the match rules, so no signal is lost in between.
+func (w *signalWatch) open(ctx context.Context) error {
+	conn, err := w.dial()
+	if err != nil {
+		return err
+	}
+	signals := make(chan *dbus.Signal, 10)
+	conn.Signal(signals)
+	if err = w.subscribe(ctx, conn); err == nil && w.name != "" {
+		err = w.verifySender(ctx, conn)
+	}
+	if err != nil {
+		_ = conn.Close()
+		return err
+	}
+	w.conn, w.signals = conn, signals
+	return nil
+}
+
+// verifySender accepts only the signals of the current owner of w.name and
+// follows NameOwnerChanged when the service restarts.
+func (w *signalWatch) verifySender(ctx context.Context, conn *dbus.Conn) error {
+	if strings.HasPrefix(w.name, ":") {
+		w.owner = w.name
+		return nil
+	}
+	err := conn.AddMatchSignal(
+		dbus.WithMatchSender(busName),
+		dbus.WithMatchInterface(busName),
+		dbus.WithMatchMember("NameOwnerChanged"),
+		dbus.WithMatchArg(0, w.name),
+	)
+	if err != nil {
+		return fmt.Errorf("subscribe on owner of %s: %w", w.name, err)
+	}
+	// Служба может быть ещё не запущена, тогда владелец придёт в
+	// NameOwnerChanged.
+	w.owner = ""
+	_ = conn.BusObject().CallWithContext(ctx, busName+".GetNameOwner", 0, w.name).Store(&w.owner)
+	return nil
+}
+
+// ownerChanged tracks the owner of the verified name. restarted is true
+// when the service got a new owner.
+func (w *signalWatch) ownerChanged(s *dbus.Signal) (tracked, restarted bool) {
+	if w.name == "" || s.Name != nameOwnerChanged || s.Sender != busName {
+		return false, false
+	}
+	if len(s.Body) == 3 && s.Body[0] == w.name {
+		w.owner, _ = s.Body[2].(string)
+		slog.Info("Signal source owner changed", slog.String("name", w.name), slog.String("owner", w.owner))
+		return true, w.owner != ""
+	}
+	return true, false
+}
+
+// accept checks the sender and path of s.
+func (w *signalWatch) accept(s *dbus.Signal) bool {
+	if s.Sender == busName {
+		// NameAcquired и прочие сигналы самой шины.
+		return false
+	}
+	if w.name != "" && (w.owner == "" || s.Sender != w.owner) {
+		w.dropped(s, "unexpected sender")
+		return false
+	}
+	if len(w.paths) > 0 && !containsPath(w.paths, s.Path) {
+		w.dropped(s, "unexpected object path")
+		return false
+	}
+	return true
+}
+
+// dropped logs a rejected signal as a security event: another process on
+// the bus may be spoofing the lock state.
+func (w *signalWatch) dropped(s *dbus.Signal, reason string) {
+	slog.Warn("Security: signal dropped",
+		slog.String("reason", reason),
+		slog.String("signal", s.Name),
+		slog.String("sender", s.Sender),
+		slog.String("path", string(s.Path)),
+		slog.String("expected", w.name),
+		slog.String("owner", w.owner))
+}
+
+// run delivers the events until ctx is done. While the bus is gone the
+// error is reported with setErr and cleared after the reconnect.
+func (w *signalWatch) run(ctx context.Context, events chan<- Lock, setErr func(error)) {
+	defer func() { _ = w.conn.Close() }()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case s, ok := <-w.signals:
+			if !ok {
+				setErr(errors.New("dbus connection closed"))
+				if !w.reconnect(ctx) {
+					return
+				}
+				setErr(nil)
+				if !w.resync(ctx, events) {
+					return
+				}
+				continue
+			}
+			if tracked, restarted := w.ownerChanged(s); tracked {
+				if restarted && !w.resync(ctx, events) {
+					return
+				}
+				continue
+			}
+			if !w.accept(s) {
+				continue
+			}
+			if l, ok := w.event(s); ok && !send(ctx, events, l) {
+				return
+			}
+		}
+	}
+}
+
+// reconnect opens a new connection with exponential backoff, false when
+// ctx is done first.
+func (w *signalWatch) reconnect(ctx context.Context) bool {
+	_ = w.conn.Close()
+	delay := reconnectMinDelay
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return false
+		case <-timer.C:
+		}
+		err := w.open(ctx)
+		if err == nil {
+			slog.Info("D-Bus connection restored")
+			return true
+		}
+		delay = min(2*delay, reconnectMaxDelay)
+		slog.Warn("Reconnect D-Bus", slog.Duration("retry", delay), slog.Any("error", err))
+		timer.Reset(delay)
+	}
+}
+
+// resync queries the state after a gap and sends it marked as Resynced.
+func (w *signalWatch) resync(ctx context.Context, events chan<- Lock) bool {
+	var (
+		states []Lock
+		err    error
+	)
+	switch {
+	case w.snapshots != nil:
+		states, err = w.snapshots(ctx, w.conn)
+	case w.state != nil:
+		var l Lock
+		if l, err = w.state(ctx, w.conn); err == nil {
+			states = []Lock{l}
+		}
+	default:
+		return true
+	}
+	// snapshots может вернуть часть состояний вместе с ошибкой.
+	if err != nil {
+		slog.Warn("Resync session state", slog.Any("error", err))
+	}
+	for _, l := range states {
+		l.Resynced = true
+		if !send(ctx, events, l) {
+			return false
+		}
+	}
+	return true
+}
+
+func containsPath(paths []dbus.ObjectPath, path dbus.ObjectPath) bool {
+	for _, p := range paths {
+		if p == path {
+			return true
+		}
+	}
+	return false
+}
@@ -26,6 +26,7 @@ const (
 	WTS_SESSION_TERMINATE      = 0xB
 
 	WM_QUERYENDSESSION   = 0x11
+	WM_QUIT              = 0x12
 	WM_WTSSESSION_CHANGE = 0x2B1
 
 	ENDSESSION_CLOSEAPP = 0x00000001
@@ -33,6 +34,8 @@ const (
 	ENDSESSION_LOGOFF   = 0x80000000
 )
 
+const ERROR_CLASS_ALREADY_EXISTS = 1410
+
 const (
 	NOTIFY_FOR_THIS_SESSION = 0
 	NOTIFY_FOR_ALL_SESSIONS = 1
@@ -144,6 +147,26 @@ const CW_USEDEFAULT int32 = ^int32(0x7FFFFFFF) // 0x80000000
 
 type WTS_CONNECTSTATE_CLASS int32
 
+const (
+	WTSActive       WTS_CONNECTSTATE_CLASS = 0
+	WTSConnected    WTS_CONNECTSTATE_CLASS = 1
+	WTSConnectQuery WTS_CONNECTSTATE_CLASS = 2
+	WTSShadow       WTS_CONNECTSTATE_CLASS = 3
+	WTSDisconnected WTS_CONNECTSTATE_CLASS = 4
+	WTSIdle         WTS_CONNECTSTATE_CLASS = 5
+	WTSListen       WTS_CONNECTSTATE_CLASS = 6
+	WTSReset        WTS_CONNECTSTATE_CLASS = 7
+	WTSDown         WTS_CONNECTSTATE_CLASS = 8
+	WTSInit         WTS_CONNECTSTATE_CLASS = 9
+)
+
+// Структура WTS_SESSION_INFOW, элемент результата WTSEnumerateSessions.
+type WTS_SESSION_INFO struct {
+	SessionId      uint32
+	WinStationName *uint16
+	State          WTS_CONNECTSTATE_CLASS
+}
+
 // Структура, аналогичная WTSINFOEX_LEVEL1_A в Go
 type WTSINFOEX_LEVEL1_A struct {
 	SessionId               uint32
@@ -170,6 +193,40 @@ type WTSINFOEXA struct {
 	Level uint32
 	Data  WTSINFOEX_LEVEL1_A
 }
+
+// Структура WTSINFOW, возвращается для WTSSessionInfo. Времена в формате
+// FILETIME.
+type WTSINFOW struct {
+	State                   WTS_CONNECTSTATE_CLASS
+	SessionId               uint32
+	IncomingBytes           uint32
+	OutgoingBytes           uint32
+	IncomingFrames          uint32
+	OutgoingFrames          uint32
+	IncomingCompressedBytes uint32
+	OutgoingCompressedBytes uint32
+	WinStationName          [WINSTATIONNAME_LENGTH]uint16
+	Domain                  [DOMAIN_LENGTH + 2]uint16
+	UserName                [USERNAME_LENGTH + 1]uint16
+	_                       [4]byte // выравнивание LARGE_INTEGER и на 386
+	ConnectTime             int64
+	DisconnectTime          int64
+	LastInputTime           int64
+	LogonTime               int64
+	CurrentTime             int64
+}
+
+const (
+	AF_INET  = 2
+	AF_INET6 = 23
+)
+
+// Структура WTS_CLIENT_ADDRESS, адрес IPv4 начинается со второго байта
+// Address.
+type WTS_CLIENT_ADDRESS struct {
+	AddressFamily uint32
+	Address       [20]byte
+}
 type HANDLE uintptr
 
 type HWND uintptr
@@ -233,23 +290,17 @@ type _WNDCLASS struct {
 type WinErrorCode uint32
 
 var (
-	hwnd HWND
-
-	chanMessages = make(chan Message, 1000)
-
 	kernel32 = syscall.MustLoadDLL("kernel32.dll")
 	wtsapi32 = syscall.MustLoadDLL("wtsapi32.dll")
 	user32   = syscall.MustLoadDLL("user32.dll")
 
-	procWTSRegisterSessionNotification = wtsapi32.MustFindProc("WTSRegisterSessionNotification")
-	procWTSQuerySessionInformation     = wtsapi32.MustFindProc("WTSQuerySessionInformationW")
-	procWTSFreeMemory                  = wtsapi32.MustFindProc("WTSFreeMemory")
-	procWTSGetActiveConsoleSessionId   = kernel32.MustFindProc("WTSGetActiveConsoleSessionId")
-	procCreateThread                   = kernel32.MustFindProc("CreateThread")
-	procTerminateThread                = kernel32.MustFindProc("TerminateThread")
-	procCloseHandle                    = kernel32.MustFindProc("CloseHandle")
-	procFormatMessage                  = kernel32.MustFindProc("FormatMessageW")
-	//	procProcessIdToSessionId           = kernel32.MustFindProc("ProcessIdToSessionId")
+	procWTSRegisterSessionNotification   = wtsapi32.MustFindProc("WTSRegisterSessionNotification")
+	procWTSUnRegisterSessionNotification = wtsapi32.MustFindProc("WTSUnRegisterSessionNotification")
+	procWTSQuerySessionInformation       = wtsapi32.MustFindProc("WTSQuerySessionInformationW")
+	procWTSFreeMemory                    = wtsapi32.MustFindProc("WTSFreeMemory")
+	procWTSEnumerateSessions             = wtsapi32.MustFindProc("WTSEnumerateSessionsW")
+	procFormatMessage                    = kernel32.MustFindProc("FormatMessageW")
+	procProcessIdToSessionId             = kernel32.MustFindProc("ProcessIdToSessionId")
 	//	procGetCurrentProcessId            = kernel32.MustFindProc("GetCurrentProcessId")
 	procTranslateMessage = user32.MustFindProc("TranslateMessage")
 	procGetMessage       = user32.MustFindProc("GetMessageW")
@@ -257,6 +308,8 @@ var (
 	procDefWindowProc    = user32.MustFindProc("DefWindowProcW")
 	procUpdateWindow     = user32.MustFindProc("UpdateWindow")
 	procCreateWindowExW  = user32.MustFindProc("CreateWindowExW")
+	procDestroyWindow    = user32.MustFindProc("DestroyWindow")
+	procPostMessage      = user32.MustFindProc("PostMessageW")
 	procRegisterClassExW = user32.MustFindProc("RegisterClassExW")
 )
 
@@ -332,6 +385,22 @@ func UpdateWindow(hWnd HWND) error {
 	}
 }
 
+func DestroyWindow(hWnd HWND) error {
+	r1, _, err := procDestroyWindow.Call(uintptr(hWnd))
+	if r1 == 0 {
+		return err
+	}
+	return nil
+}
+
+func PostMessage(hWnd HWND, msg uint32, wParam uintptr, lParam uintptr) error {
+	r1, _, err := procPostMessage.Call(uintptr(hWnd), uintptr(msg), wParam, lParam)
+	if r1 == 0 {
+		return err
+	}
+	return nil
+}
+
 func CreateWindowExW(ClassName string, WindowName string, Style uint32, ExStyle uint32,
 	X int32, Y int32, Width int32, Height int32,
 	WndParent HWND, Menu HMENU, inst HINSTANCE, Param uintptr) (hWnd HWND, err error) {
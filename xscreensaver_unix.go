@@ -0,0 +1,221 @@
+//go:build linux
+
+package notify_lock_session
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// BackendXScreenSaver watches xscreensaver, which has no D-Bus interface,
+// through `xscreensaver-command -watch`.
+const BackendXScreenSaver = "xscreensaver"
+
+// Задержки перед перезапуском xscreensaver-command.
+const (
+	restartMinDelay = 100 * time.Millisecond
+	restartMaxDelay = 30 * time.Second
+	// restartHealthy is how long a run must stay up to reset the delay.
+	restartHealthy = 10 * time.Second
+)
+
+// XScreenSaverBackend runs `xscreensaver-command -watch` and restarts it
+// when it exits.
+type XScreenSaverBackend struct {
+	baseBackend
+	command string
+}
+
+func NewXScreenSaverBackend() *XScreenSaverBackend {
+	return &XScreenSaverBackend{command: "xscreensaver-command"}
+}
+
+func (b *XScreenSaverBackend) Name() string { return BackendXScreenSaver }
+
+func (b *XScreenSaverBackend) Capabilities() Capability {
+	return CapLock | CapScreenSaver | CapState
+}
+
+// State asks `xscreensaver-command -time`.
+func (b *XScreenSaverBackend) State(ctx context.Context) (Lock, error) {
+	out, err := exec.CommandContext(ctx, b.command, "-time").Output()
+	if err != nil {
+		return Lock{}, fmt.Errorf("%s -time: %w", b.command, err)
+	}
+	kind, ok := xscreensaverTime(string(out))
+	if !ok {
+		return Lock{}, fmt.Errorf("%s -time: unexpected output %q", b.command, strings.TrimSpace(string(out)))
+	}
+	return newSnapshot(kind, BackendXScreenSaver, "xscreensaver-command -time"), nil
+}
+
+// xscreensaverTime parses "XScreenSaver 6.06: screen locked since ...".
+func xscreensaverTime(out string) (EventKind, bool) {
+	switch {
+	case strings.Contains(out, "screen locked"):
+		return EventLocked, true
+	case strings.Contains(out, "screen non-blanked"):
+		return EventScreenSaverStop, true
+	case strings.Contains(out, "screen blanked"):
+		return EventScreenSaverStart, true
+	}
+	return EventUnknown, false
+}
+
+func (b *XScreenSaverBackend) Start(ctx context.Context, events chan<- Lock) error {
+	if _, err := exec.LookPath(b.command); err != nil {
+		return &CapabilityError{Backend: BackendXScreenSaver, Err: err}
+	}
+	// UNBLANK при уже заблокированном экране - это разблокировка.
+	locked := false
+	if state, err := b.State(ctx); err == nil {
+		locked = state.Kind == EventLocked
+	}
+	ctx = b.watch(ctx)
+	lines, err := b.run(ctx)
+	if err != nil {
+		return err
+	}
+	go b.supervise(ctx, lines, events, locked)
+	return nil
+}
+
+// run starts one `-watch` process. lines is closed when it exits.
+func (b *XScreenSaverBackend) run(ctx context.Context) (<-chan string, error) {
+	cmd := exec.CommandContext(ctx, b.command, "-watch")
+	cmd.WaitDelay = time.Second
+	out, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err = cmd.Start(); err != nil {
+		return nil, fmt.Errorf("%s -watch: %w", b.command, err)
+	}
+
+	lines := make(chan string)
+	go func() {
+		defer close(lines)
+		scanner := bufio.NewScanner(out)
+		for scanner.Scan() {
+			select {
+			case lines <- scanner.Text():
+			case <-ctx.Done():
+			}
+		}
+		err := cmd.Wait()
+		if ctx.Err() == nil {
+			slog.Warn("xscreensaver-command exited", slog.Any("error", err))
+		}
+	}()
+	return lines, nil
+}
+
+// supervise maps the lines to events and restarts the command with
+// exponential backoff until ctx is done. locked is the state at Start.
+func (b *XScreenSaverBackend) supervise(ctx context.Context, lines <-chan string, events chan<- Lock, locked bool) {
+	delay := restartMinDelay
+	for {
+		healthy := b.forward(ctx, lines, events, &locked)
+		if ctx.Err() != nil {
+			return
+		}
+		if healthy {
+			delay = restartMinDelay
+		}
+
+		b.setErr(errors.New("xscreensaver-command exited"))
+		if lines = b.restart(ctx, &delay); lines == nil {
+			return
+		}
+
+		// Пока команда не работала, события могли быть пропущены.
+		state, err := b.State(ctx)
+		if err != nil {
+			slog.Warn("Resync session state", slog.Any("error", err))
+			continue
+		}
+		state.Resynced = true
+		locked = state.Kind == EventLocked
+		if !send(ctx, events, state) {
+			return
+		}
+	}
+}
+
+// forward sends the events of one run until it exits. The run is healthy
+// once it printed a line or stayed up for restartHealthy; only then the
+// error of the previous run is cleared.
+func (b *XScreenSaverBackend) forward(ctx context.Context, lines <-chan string, events chan<- Lock, locked *bool) (healthy bool) {
+	timer := time.NewTimer(restartHealthy)
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return healthy
+		case <-timer.C:
+			healthy = true
+			b.setErr(nil)
+		case line, ok := <-lines:
+			if !ok {
+				return healthy
+			}
+			if !healthy {
+				healthy = true
+				b.setErr(nil)
+			}
+			kind, ok := xscreensaverEvent(line, *locked)
+			if !ok {
+				continue
+			}
+			*locked = kind == EventLocked
+			if !send(ctx, events, newLock(kind, BackendXScreenSaver, line)) {
+				return healthy
+			}
+		}
+	}
+}
+
+// restart waits for delay and runs the command again, doubling delay after
+// every attempt. It returns nil when ctx is done first.
+func (b *XScreenSaverBackend) restart(ctx context.Context, delay *time.Duration) <-chan string {
+	timer := time.NewTimer(*delay)
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-timer.C:
+		}
+		*delay = min(2**delay, restartMaxDelay)
+		lines, err := b.run(ctx)
+		if err == nil {
+			return lines
+		}
+		slog.Warn("Restart xscreensaver-command", slog.Duration("retry", *delay), slog.Any("error", err))
+		timer.Reset(*delay)
+	}
+}
+
+// xscreensaverEvent maps a line of `xscreensaver-command -watch`. UNBLANK
+// after LOCK means the user unlocked.
+func xscreensaverEvent(line string, locked bool) (EventKind, bool) {
+	word, _, _ := strings.Cut(strings.TrimSpace(line), " ")
+	switch word {
+	case "BLANK":
+		return EventScreenSaverStart, true
+	case "LOCK":
+		return EventLocked, true
+	case "UNBLANK":
+		if locked {
+			return EventUnlocked, true
+		}
+		return EventScreenSaverStop, true
+	}
+	return EventUnknown, false
+}
@@ -0,0 +1,175 @@
+//go:build linux
+
+package notify_lock_session
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeXScreenSaverCommand is a script standing in for xscreensaver-command.
+// Run N of -watch prints watchN and waits for exitN, then replaces the -time
+// output with afterN and exits.
+const fakeXScreenSaverCommand = `#!/bin/sh
+cd "$(dirname "$0")"
+case "$1" in
+-time) cat time ;;
+-watch)
+	n=$(( $(cat runs 2>/dev/null || echo 0) + 1 ))
+	echo $n > runs
+	cat watch$n
+	while [ ! -f exit$n ]; do sleep 0.01; done
+	[ -f after$n ] && cp after$n time
+	;;
+esac
+`
+
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestXScreenSaverBackend(t *testing.T) {
+	dir := t.TempDir()
+	command := filepath.Join(dir, "xscreensaver-command")
+	if err := os.WriteFile(command, []byte(fakeXScreenSaverCommand), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	writeFiles(t, dir, map[string]string{
+		"time":   "XScreenSaver 6.06: screen non-blanked since Sat Oct 18 10:00:00 2026\n",
+		"watch1": "RUN 0\nBLANK Sat Oct 18 10:05:00 2026\nLOCK Sat Oct 18 10:05:10 2026\n",
+		// Команда завершилась, пока экран был заблокирован.
+		"after1": "XScreenSaver 6.06: screen locked since Sat Oct 18 10:05:10 2026\n",
+		"watch2": "UNBLANK Sat Oct 18 10:07:00 2026\n",
+	})
+
+	b := NewXScreenSaverBackend()
+	b.command = command
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	lock := make(chan Lock, 10)
+	if err := New(UseBackend(b)).Subscribe(ctx, lock); err != nil {
+		t.Fatal(err)
+	}
+
+	if l := nextLock(t, lock); !l.Snapshot || l.Kind != EventScreenSaverStop {
+		t.Errorf("snapshot = %+v", l)
+	}
+	if l := nextLock(t, lock); l.Kind != EventScreenSaverStart || l.Backend != BackendXScreenSaver {
+		t.Errorf("blank = %+v", l)
+	}
+	if l := nextLock(t, lock); l.Kind != EventLocked {
+		t.Errorf("lock = %+v", l)
+	}
+	writeFiles(t, dir, map[string]string{"exit1": ""})
+	if l := nextLock(t, lock); l.Kind != EventLocked || !l.Resynced {
+		t.Errorf("after restart = %+v", l)
+	}
+	if l := nextLock(t, lock); l.Kind != EventUnlocked {
+		t.Errorf("unblank = %+v", l)
+	}
+	if err := b.Err(); err != nil {
+		t.Errorf("Err() = %v", err)
+	}
+}
+
+func TestXScreenSaverStartLocked(t *testing.T) {
+	dir := t.TempDir()
+	command := filepath.Join(dir, "xscreensaver-command")
+	if err := os.WriteFile(command, []byte(fakeXScreenSaverCommand), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	writeFiles(t, dir, map[string]string{
+		"time":   "XScreenSaver 6.06: screen locked since Sat Oct 18 10:05:10 2026\n",
+		"watch1": "UNBLANK Sat Oct 18 10:07:00 2026\n",
+	})
+
+	b := NewXScreenSaverBackend()
+	b.command = command
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	lock := make(chan Lock, 10)
+	if err := New(UseBackend(b)).Subscribe(ctx, lock); err != nil {
+		t.Fatal(err)
+	}
+
+	if l := nextLock(t, lock); !l.Snapshot || l.Kind != EventLocked {
+		t.Errorf("snapshot = %+v", l)
+	}
+	if l := nextLock(t, lock); l.Kind != EventUnlocked {
+		t.Errorf("unblank = %+v", l)
+	}
+}
+
+func TestXScreenSaverBackoff(t *testing.T) {
+	dir := t.TempDir()
+	command := filepath.Join(dir, "xscreensaver-command")
+	// Каждый запуск сразу завершается, как без работающего xscreensaver.
+	script := "#!/bin/sh\ncd \"$(dirname \"$0\")\"\n[ \"$1\" = -watch ] && echo >> runs\nexit 1\n"
+	if err := os.WriteFile(command, []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	b := NewXScreenSaverBackend()
+	b.command = command
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := b.Start(ctx, make(chan Lock, 10)); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(time.Second)
+
+	// Задержки 100, 200 и 400 мс: не больше четырёх запусков за секунду.
+	runs, err := os.ReadFile(filepath.Join(dir, "runs"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := strings.Count(string(runs), "\n"); n < 2 || n > 4 {
+		t.Errorf("runs = %d", n)
+	}
+	if err := b.Err(); err == nil {
+		t.Error("Err() = nil")
+	}
+}
+
+func TestXScreenSaverEvent(t *testing.T) {
+	tests := []struct {
+		line   string
+		locked bool
+		kind   EventKind
+		ok     bool
+	}{
+		{"BLANK Sat Oct 18 10:05:00 2026", false, EventScreenSaverStart, true},
+		{"LOCK Sat Oct 18 10:05:10 2026", false, EventLocked, true},
+		{"UNBLANK Sat Oct 18 10:07:00 2026", true, EventUnlocked, true},
+		{"UNBLANK Sat Oct 18 10:07:00 2026", false, EventScreenSaverStop, true},
+		{"RUN 3", false, EventUnknown, false},
+		{"THROTTLE Sat Oct 18 10:05:00 2026", false, EventUnknown, false},
+		{"", false, EventUnknown, false},
+	}
+	for _, tt := range tests {
+		kind, ok := xscreensaverEvent(tt.line, tt.locked)
+		if kind != tt.kind || ok != tt.ok {
+			t.Errorf("xscreensaverEvent(%q, %v) = %v, %v", tt.line, tt.locked, kind, ok)
+		}
+	}
+}
+
+func TestXScreenSaverMissing(t *testing.T) {
+	b := NewXScreenSaverBackend()
+	b.command = filepath.Join(t.TempDir(), "xscreensaver-command")
+	err := New(UseBackend(b)).Subscribe(context.Background(), make(chan Lock, 1))
+	var capErr *CapabilityError
+	if !errors.Is(err, errors.ErrUnsupported) || !errors.As(err, &capErr) || capErr.Backend != BackendXScreenSaver {
+		t.Errorf("Subscribe() = %v", err)
+	}
+}